@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/link"
+)
+
+// attachmentFile is an attachment of an original message re-uploaded with its copies.
+type attachmentFile struct {
+	attachment *discordgo.MessageAttachment
+	// data is nil when the relay doesn't upload files, as when editing mirrors
+	data []byte
+	// description is the alt text of the attachment
+	description string
+}
+
+// uploadAttachment describes a file uploaded with a message, Discord matching it to the file of the same index.
+type uploadAttachment struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"`
+	Description string `json:"description,omitempty"`
+}
+
+// attachmentFiles returns the attachments of a message which are re-uploaded with its copies, by attachment ID.
+// Attachments larger than the configured limit, past the configured total of a message, or which cannot be downloaded,
+// are left out to be linked instead.
+// The descriptions of the attachments are uploaded along with them.
+func (ab *AgoraBot) attachmentFiles(m *discordgo.Message, download bool, descriptions map[string]string) map[string]attachmentFile {
+	files := make(map[string]attachmentFile)
+	var total int64
+
+	for _, attachment := range m.Attachments {
+		size := int64(attachment.Size)
+		// Discord refuses the whole message when its files exceed the upload limit
+		if size > ab.Conf.MaxAttachmentSize || total+size > ab.Conf.MaxUploadSize {
+			continue
+		}
+
+		if !download {
+			files[attachment.ID] = attachmentFile{attachment: attachment}
+			total += size
+			continue
+		}
+
+		data, errDownload := ab.downloadAttachment(attachment)
+		if errDownload != nil {
+			log.Printf("Error downloading attachment %s: %v\n", attachment.ID, errDownload)
+			continue
+		}
+		files[attachment.ID] = attachmentFile{attachment: attachment, data: data, description: descriptions[attachment.ID]}
+		total += size
+	}
+
+	return files
+}
+
+// downloadAttachment downloads the content of an attachment, within the configured size limit.
+func (ab *AgoraBot) downloadAttachment(attachment *discordgo.MessageAttachment) ([]byte, error) {
+	resp, errGet := ab.httpClient.Get(attachment.URL)
+	if errGet != nil {
+		return nil, errGet
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, errRead := io.ReadAll(io.LimitReader(resp.Body, ab.Conf.MaxAttachmentSize+1))
+	if errRead != nil {
+		return nil, errRead
+	}
+	if int64(len(data)) > ab.Conf.MaxAttachmentSize {
+		return nil, fmt.Errorf("attachment exceeds %d bytes", ab.Conf.MaxAttachmentSize)
+	}
+
+	return data, nil
+}
+
+// uploads returns the files uploaded with a copy of the message, and the attachments describing them.
+// Filenames are kept as is, which preserves the spoiler flag of attachments.
+func (rl *relay) uploads() ([]*discordgo.File, []uploadAttachment) {
+	var files []*discordgo.File
+	var attachments []uploadAttachment
+
+	for _, attachment := range rl.message.Attachments {
+		file, ok := rl.files[attachment.ID]
+		if !ok || file.data == nil {
+			continue
+		}
+
+		attachments = append(attachments, uploadAttachment{
+			ID:          len(files),
+			Filename:    attachment.Filename,
+			Description: file.description,
+		})
+		files = append(files, &discordgo.File{
+			Name:        attachment.Filename,
+			ContentType: attachment.ContentType,
+			Reader:      bytes.NewReader(file.data),
+		})
+	}
+
+	return files, attachments
+}
+
+// messageUpload is a message sent with files described by their attachments.
+type messageUpload struct {
+	*discordgo.MessageSend
+	Attachments []uploadAttachment `json:"attachments,omitempty"`
+}
+
+// upload posts a payload with files to an endpoint and decodes the response into v.
+// discordgo cannot describe the files it uploads, so messages with files are sent through this raw request.
+func upload(s *discordgo.Session, endpoint string, bucket string, data interface{}, files []*discordgo.File, v interface{}) error {
+	contentType, body, errBody := discordgo.MultipartBodyWithJSON(data, files)
+	if errBody != nil {
+		return errBody
+	}
+
+	response, errPost := s.RequestWithLockedBucket(http.MethodPost, endpoint, contentType, body, s.Ratelimiter.LockBucket(bucket), 0, deliveryOptions...)
+	if errPost != nil {
+		return errPost
+	}
+	return json.Unmarshal(response, v)
+}
+
+// channelMessageSend sends a message as the bot, its files keeping the descriptions of the attachments.
+func channelMessageSend(s *discordgo.Session, channelID string, data *discordgo.MessageSend, attachments []uploadAttachment) (*discordgo.Message, error) {
+	if len(data.Files) == 0 {
+		return s.ChannelMessageSendComplex(channelID, data, deliveryOptions...)
+	}
+
+	endpoint := discordgo.EndpointChannelMessages(channelID)
+	var msg *discordgo.Message
+	errUpload := upload(s, endpoint, endpoint, messageUpload{MessageSend: data, Attachments: attachments}, data.Files, &msg)
+	return msg, errUpload
+}
+
+// forumThreadStart creates a forum post of the bot, the files of its starter message keeping the descriptions of the attachments.
+func forumThreadStart(s *discordgo.Session, channelID string, thread *discordgo.ThreadStart, data *discordgo.MessageSend, attachments []uploadAttachment) (*discordgo.Channel, error) {
+	if len(data.Files) == 0 {
+		return s.ForumThreadStartComplex(channelID, thread, data, deliveryOptions...)
+	}
+
+	endpoint := discordgo.EndpointChannelThreads(channelID)
+	post := struct {
+		*discordgo.ThreadStart
+		Message messageUpload `json:"message"`
+	}{ThreadStart: thread, Message: messageUpload{MessageSend: data, Attachments: attachments}}
+
+	var channel *discordgo.Channel
+	errUpload := upload(s, endpoint, endpoint, post, data.Files, &channel)
+	return channel, errUpload
+}
+
+// keptAttachments returns the attachments a mirror keeps once the files removed from the original are dropped,
+// or nil when the mirror keeps all of them.
+func (ab *AgoraBot) keptAttachments(s *discordgo.Session, mirror link.Mirror, rl *relay) (*[]*discordgo.MessageAttachment, error) {
+	ab.prepare(s, rl)
+
+	remaining := make(map[string]int)
+	for _, attachment := range rl.message.Attachments {
+		if _, ok := rl.files[attachment.ID]; ok {
+			remaining[attachment.Filename]++
+		}
+	}
+
+	current, errMessage := s.ChannelMessage(mirror.ChannelID, mirror.MessageID, deliveryOptions...)
+	if errMessage != nil {
+		return nil, errMessage
+	}
+
+	kept := []*discordgo.MessageAttachment{}
+	for _, attachment := range current.Attachments {
+		if remaining[attachment.Filename] > 0 {
+			remaining[attachment.Filename]--
+			kept = append(kept, attachment)
+		}
+	}
+
+	if len(kept) == len(current.Attachments) {
+		return nil, nil
+	}
+	return &kept, nil
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// auditLogWindow is how recent an audit log entry must be to be attributed to a gateway event.
+const auditLogWindow = time.Minute
+
+// auditEntryRetention is how long the attributions of an audit log entry are remembered after it was last seen.
+const auditEntryRetention = time.Hour
+
+// auditTracker remembers how many actions of each audit log entry were already attributed to gateway events.
+// Discord merges repeated message deletions by the same user into a single entry and only raises its count,
+// so an entry stands for a new action whenever its count grew since it was last attributed.
+type auditTracker struct {
+	mu      sync.Mutex
+	entries map[string]trackedEntry
+}
+
+// trackedEntry is the number of actions of an audit log entry which were attributed.
+type trackedEntry struct {
+	attributed int
+	seenAt     time.Time
+}
+
+func newAuditTracker() *auditTracker {
+	return &auditTracker{entries: make(map[string]trackedEntry)}
+}
+
+// claim attributes one action of an audit log entry holding count actions, and reports whether one was left.
+// Entries seen for the first time only hold a new action when they are recent,
+// their older actions having happened before the bot could attribute them.
+func (t *auditTracker) claim(entryID string, count int, created time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, entry := range t.entries {
+		if now.Sub(entry.seenAt) > auditEntryRetention {
+			delete(t.entries, id)
+		}
+	}
+
+	entry, ok := t.entries[entryID]
+	if !ok && now.Sub(created) > auditLogWindow {
+		entry.attributed = count
+	}
+	entry.seenAt = now
+
+	claimed := entry.attributed < count
+	if claimed {
+		entry.attributed++
+	}
+	t.entries[entryID] = entry
+	return claimed
+}
+
+// auditLogActor returns the user responsible for the latest action of the given type in a channel, according to the guild's audit log.
+// When targetID or messageID are set, only entries about that target or message are considered.
+// Each action is attributed once, so that a lookup doesn't credit a user with an action already attributed to another event.
+// It returns false when no new entry matches or when the bot cannot read the audit log.
+func (ab *AgoraBot) auditLogActor(s *discordgo.Session, guildID string, channelID string, targetID string, messageID string, action discordgo.AuditLogAction) (string, bool) {
+	auditLog, errLog := s.GuildAuditLog(guildID, "", "", int(action), 10)
+	if errLog != nil {
+		return "", false
+	}
+
+	for _, entry := range auditLog.AuditLogEntries {
+		created, errTime := discordgo.SnowflakeTimestamp(entry.ID)
+		if errTime != nil {
+			continue
+		}
+
+		entryChannelID := entry.TargetID
+		entryMessageID := ""
+		count := 1
+		if entry.Options != nil {
+			if entry.Options.ChannelID != "" {
+				entryChannelID = entry.Options.ChannelID
+			}
+			entryMessageID = entry.Options.MessageID
+			// The count of bulk deletions is the number of deleted messages rather than of merged actions
+			if n, errCount := strconv.Atoi(entry.Options.Count); errCount == nil && action == discordgo.AuditLogActionMessageDelete {
+				count = n
+			}
+		}
+
+		if entryChannelID != channelID || (targetID != "" && entry.TargetID != targetID) || (messageID != "" && entryMessageID != messageID) {
+			continue
+		}
+		if ab.audits.claim(entry.ID, count, created) {
+			return entry.UserID, true
+		}
+	}
+
+	return "", false
+}
+
+// auditLogDeleter returns a function looking up, at most once, who deleted messages in a channel.
+// The function is given the author of the deleted message, which single deletions are matched against.
+func (ab *AgoraBot) auditLogDeleter(s *discordgo.Session, guildID string, channelID string, action discordgo.AuditLogAction) func(authorID string) string {
+	var once sync.Once
+	var deleterID string
+
+	return func(authorID string) string {
+		once.Do(func() {
+			// Bulk deletions target the channel rather than the authors of the messages
+			if action == discordgo.AuditLogActionMessageBulkDelete {
+				authorID = ""
+			}
+			deleterID, _ = ab.auditLogActor(s, guildID, channelID, authorID, "", action)
+		})
+		return deleterID
+	}
+}
@@ -0,0 +1,34 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditTrackerClaim(t *testing.T) {
+	tracker := newAuditTracker()
+	now := time.Now()
+
+	if !tracker.claim("recent", 1, now) {
+		t.Error("new recent entry wasn't claimed")
+	}
+	if tracker.claim("recent", 1, now) {
+		t.Error("entry was claimed twice for the same action")
+	}
+
+	// Discord merged two more deletions into the entry
+	if !tracker.claim("recent", 3, now) || !tracker.claim("recent", 3, now) {
+		t.Error("actions merged into a seen entry weren't claimed")
+	}
+	if tracker.claim("recent", 3, now) {
+		t.Error("entry was claimed more times than its count")
+	}
+
+	old := now.Add(-2 * auditLogWindow)
+	if tracker.claim("old", 2, old) {
+		t.Error("actions of an old entry seen for the first time were claimed")
+	}
+	if !tracker.claim("old", 3, old) {
+		t.Error("action merged into an old entry after it was seen wasn't claimed")
+	}
+}
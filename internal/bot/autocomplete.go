@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// maxChoices is the number of suggestions Discord accepts for an autocompleted option.
+const maxChoices = 25
+
+// canSeeHub reports whether a user in a guild may find a hub, which is either public,
+// moderated by the user or already linked to a channel of the guild.
+func canSeeHub(s *discordgo.Session, h hub.Hub, userID string, guildID string) bool {
+	return canJoinHub(h, userID) || hasChannelInGuild(s, h, guildID)
+}
+
+// canJoinHub reports whether a user may link channels to a hub.
+func canJoinHub(h hub.Hub, userID string) bool {
+	return h.Settings.Public || h.IsModerator(userID)
+}
+
+// handleHubAutocomplete suggests the hubs matching the focused option of a subcommand of /hub,
+// among the hubs the invoking user is allowed to act on with it.
+func (ab *AgoraBot) handleHubAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ApplicationCommandInteractionData) {
+	if len(data.Options) == 0 {
+		return
+	}
+	sub := data.Options[0]
+
+	var prefix string
+	for _, option := range sub.Options {
+		if option.Focused {
+			prefix = strings.TrimSpace(option.StringValue())
+		}
+	}
+
+	hubs, errHubs := queries.SearchHubsQuery{}.Do(ab.GetQueryDeps(), store.SearchHubsParams{Prefix: prefix})
+	if errHubs != nil {
+		log.Printf("Error searching hubs: %v\n", errHubs)
+		hubs = nil
+	}
+
+	userID := interactionUser(i).ID
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, h := range hubs {
+		if len(choices) == maxChoices {
+			break
+		}
+
+		var allowed bool
+		switch sub.Name {
+		case "delete", "deadletters":
+			allowed = h.OwnerID == userID
+		case "join":
+			allowed = canJoinHub(h, userID)
+		case "settings":
+			allowed = h.IsModerator(userID)
+		default:
+			allowed = canSeeHub(s, h, userID, i.GuildID)
+		}
+		if !allowed {
+			continue
+		}
+
+		// Names are limited to 100 characters like choices, and the ID keeps the choice valid if the hub is renamed
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  h.Name,
+			Value: h.ID.Hex(),
+		})
+	}
+
+	errRespond := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if errRespond != nil {
+		log.Printf("Error responding to autocomplete: %v\n", errRespond)
+	}
+}
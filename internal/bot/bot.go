@@ -2,19 +2,27 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/maaxleq/agora-bot/internal/config"
+	"github.com/maaxleq/agora-bot/internal/dispatch"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
 	"github.com/maaxleq/agora-bot/internal/query"
 	"github.com/maaxleq/agora-bot/internal/query/queries"
 	"github.com/maaxleq/agora-bot/internal/store"
 	storeloader "github.com/maaxleq/agora-bot/internal/store/loader"
+	"github.com/maaxleq/agora-bot/internal/store/stores"
 )
 
 // AgoraBot represents a Discord bot with configuration and session information.
@@ -22,6 +30,15 @@ type AgoraBot struct {
 	Conf    config.Config
 	Session *discordgo.Session
 	Store   *store.Storer
+
+	httpClient *http.Client
+	dispatcher *dispatch.Dispatcher
+	loops      *loopDetector
+	typing     *typingDebouncer
+	pins       *pinCache
+	digests    *reactionDigester
+	audits     *auditTracker
+	webhookMu  sync.Mutex
 }
 
 // NewAgoraBot creates a new instance of AgoraBot with the provided configuration.
@@ -36,11 +53,21 @@ func NewAgoraBot(conf config.Config) (*AgoraBot, error) {
 		return nil, fmt.Errorf("error loading store: %w", errStore)
 	}
 
-	return &AgoraBot{
+	ab := &AgoraBot{
 		Conf:    conf,
 		Session: dg,
 		Store:   store,
-	}, nil
+
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		loops:      newLoopDetector(conf.DuplicateWindow),
+		typing:     newTypingDebouncer(),
+		pins:       newPinCache(),
+		digests:    newReactionDigester(conf.ReactionDigestWindow),
+		audits:     newAuditTracker(),
+	}
+	ab.dispatcher = dispatch.New(conf.DispatchWorkers, conf.DispatchQueueSize, conf.DispatchEnqueueTimeout, conf.DispatchIdleTimeout, ab.retryDelivery)
+
+	return ab, nil
 }
 
 func (ab *AgoraBot) GetQueryDeps() query.QueryDeps {
@@ -57,11 +84,28 @@ func (ab *AgoraBot) Run() error {
 		return fmt.Errorf("error opening connection: %w", errOpen)
 	}
 
-	// Add message handler
+	// Add message handlers
 	ab.Session.AddHandler(ab.handleMessage)
+	ab.Session.AddHandler(ab.handleMessageUpdate)
+	ab.Session.AddHandler(ab.handleMessageDelete)
+	ab.Session.AddHandler(ab.handleMessageDeleteBulk)
 	// Add reaction handlers
 	ab.Session.AddHandler(ab.handleReactionAdd)
 	ab.Session.AddHandler(ab.handleReactionRemove)
+	// Add thread handlers
+	ab.Session.AddHandler(ab.handleThreadCreate)
+	ab.Session.AddHandler(ab.handleThreadUpdate)
+	ab.Session.AddHandler(ab.handleThreadDelete)
+	// Add typing handler
+	ab.Session.AddHandler(ab.handleTypingStart)
+	// Add pin handler
+	ab.Session.AddHandler(ab.handleChannelPinsUpdate)
+	// Add command handlers
+	ab.Session.AddHandler(ab.handleInteraction)
+	errCommands := ab.registerCommands(ab.Session)
+	if errCommands != nil {
+		log.Printf("Error registering commands: %v\n", errCommands)
+	}
 
 	log.Println("Agora Bot running")
 
@@ -83,6 +127,15 @@ func (ab *AgoraBot) Run() error {
 
 	<-sc
 
+	// Deliver the queued messages before closing the connection
+	ab.dispatcher.Close()
+	stats := ab.dispatcher.Stats()
+	log.Printf("Dispatched %d jobs, dropped %d, failed %d\n", stats.Delivered, stats.Dropped, stats.Failed)
+	if cached, ok := (*ab.Store).(*stores.CachedStore); ok {
+		cacheStats := cached.Stats()
+		log.Printf("Hub cache served %d lookups, missed %d\n", cacheStats.Hits, cacheStats.Misses)
+	}
+
 	ab.Session.Close()
 
 	log.Println("Agora Bot stopped")
@@ -97,116 +150,187 @@ func (ab *AgoraBot) handleMessage(s *discordgo.Session, m *discordgo.MessageCrea
 		return
 	}
 
-	// Check if message channel is in any hub
-	h, errHub := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: m.ChannelID})
+	// Ignore system messages such as join notices
+	if !isRelayable(m.Message) {
+		return
+	}
+
+	// Ignore messages relayed through the bot's own webhooks
+	if m.WebhookID != "" && ab.isOwnWebhook(s, m.ChannelID, m.WebhookID) {
+		return
+	}
+
+	// Ignore the starter messages of forum posts, which are relayed along with their post
+	if m.ID == m.ChannelID {
+		return
+	}
+
+	// Check if message channel is in any hub, or is a thread mirrored across one
+	h, targets, errHub := ab.channelHub(s, m.ChannelID)
 	if errHub != nil {
-		log.Printf("Error getting hub of channel: %v\n", errHub)
+		if !errors.Is(errHub, store.ErrNotFound) {
+			log.Printf("Error getting hub of channel: %v\n", errHub)
+		}
 		return
 	}
 
+	// Ignore other bridges, echoes and the bots and webhooks the hub doesn't relay
+	if !ab.shouldRelay(h, m.Message) {
+		return
+	}
+	ab.loops.remember(h.ID.Hex(), m.Content)
+
+	// Record the original message so that its mirrors can be found later
+	_, errLink := queries.AddMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.AddMessageLinkParams{
+		Link: link.MessageLink{
+			OriginMessageID: m.ID,
+			OriginChannelID: m.ChannelID,
+			OriginGuildID:   m.GuildID,
+			HubID:           h.ID,
+			Fingerprint:     relayFingerprint(m.Message),
+			CreatedAt:       time.Now(),
+		},
+	})
+	if errLink != nil {
+		log.Printf("Error recording message link: %v\n", errLink)
+	}
+
+	rl := ab.newRelay(h, m.Message, true)
+
 	// Echo message to other channels in the hub
-	for _, targetChannelID := range h.Channels {
-		if targetChannelID != m.ChannelID {
-			// Create webhook message content
-			content := fmt.Sprintf("**%s** (from <#%s>):\n%s",
-				m.Author.Username,
-				m.ChannelID,
-				m.Content,
-			)
-
-			// Handle attachments if any
-			if len(m.Attachments) > 0 {
-				for _, attachment := range m.Attachments {
-					content += fmt.Sprintf("\n%s", attachment.URL)
-				}
-			}
+	for _, targetChannelID := range targets {
+		ab.enqueueRelay(s, h, targetChannelID, rl, errLink == nil, 0)
+	}
+}
 
-			_, err := s.ChannelMessageSend(targetChannelID, content)
-			if err != nil {
-				log.Printf("Error sending message to channel %s: %v\n", targetChannelID, err)
-			}
+// handleMessageUpdate processes message edits and applies them to the mirrored copies in the hub
+func (ab *AgoraBot) handleMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	// Ignore edits from the bot itself
+	if m.Author != nil && m.Author.ID == s.State.User.ID {
+		return
+	}
+
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: m.ID})
+	if errLink != nil {
+		if !errors.Is(errLink, store.ErrNotFound) {
+			log.Printf("Error getting message link: %v\n", errLink)
 		}
+		return
 	}
-}
 
-// handleReactionAdd processes reaction additions and echoes them to other channels in the same hub
-func (ab *AgoraBot) handleReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
-	// Ignore reactions from the bot itself
-	if r.UserID == s.State.User.ID {
+	// Only edits of the original message are propagated, edits of mirrors come from the bot
+	if l.OriginMessageID != m.ID {
 		return
 	}
 
-	// Check if message channel is in any hub
-	h, errHub := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: r.ChannelID})
-	if errHub != nil {
-		log.Printf("Error getting hub of channel: %v\n", errHub)
+	// Partial updates, such as embeds being added by Discord, don't carry the whole message
+	msg := m.Message
+	if msg.Author == nil {
+		full, errMessage := s.ChannelMessage(m.ChannelID, m.ID)
+		if errMessage != nil {
+			log.Printf("Error getting message %s: %v\n", m.ID, errMessage)
+			return
+		}
+		full.GuildID = m.GuildID
+		msg = full
+	}
+
+	// Updates which don't change the copies, such as link previews being added or flags changing, are not relayed
+	fingerprint := relayFingerprint(msg)
+	if fingerprint != "" && fingerprint == l.Fingerprint {
 		return
 	}
+	_, errFingerprint := queries.SetFingerprintQuery{}.Do(ab.GetQueryDeps(), store.SetFingerprintParams{
+		OriginMessageID: l.OriginMessageID,
+		Fingerprint:     fingerprint,
+	})
+	if errFingerprint != nil {
+		log.Printf("Error recording fingerprint of message %s: %v\n", m.ID, errFingerprint)
+	}
 
-	// Get the user who added the reaction
-	user, err := s.User(r.UserID)
-	if err != nil {
-		log.Printf("Error getting user: %v\n", err)
+	h, targets, errHub := ab.channelHub(s, l.OriginChannelID)
+	if errHub != nil {
+		log.Printf("Error getting hub: %v\n", errHub)
 		return
 	}
 
-	// Echo reaction to other channels in the hub
-	for _, targetChannelID := range h.Channels {
-		if targetChannelID != r.ChannelID {
-			// Create message about the reaction
-			messageLink := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", r.GuildID, r.ChannelID, r.MessageID)
-			content := fmt.Sprintf("**%s** reacted with %s to [a message](%s) in <#%s>",
-				user.Username,
-				r.Emoji.MessageFormat(),
-				messageLink,
-				r.ChannelID,
-			)
-
-			_, err := s.ChannelMessageSend(targetChannelID, content)
-			if err != nil {
-				log.Printf("Error sending message: %v\n", err)
-			}
+	rl := ab.newRelay(h, msg, false)
+
+	// Copies may also live outside of the relay targets, such as the starter messages of mirrored forum posts
+	for _, mirror := range l.Mirrors {
+		if !slices.Contains(targets, mirror.ChannelID) {
+			targets = append(targets, mirror.ChannelID)
 		}
 	}
+
+	// Apply the edit to every mirror of the message, queued after the relay of the message itself
+	for _, targetChannelID := range targets {
+		ab.enqueueEdit(s, h, targetChannelID, rl)
+	}
 }
 
-// handleReactionRemove processes reaction removals and echoes them to other channels in the same hub
-func (ab *AgoraBot) handleReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+// handleMessageDelete processes message deletions and propagates them to the linked copies in the hub
+func (ab *AgoraBot) handleMessageDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
+	deleter := ab.auditLogDeleter(s, m.GuildID, m.ChannelID, discordgo.AuditLogActionMessageDelete)
+	ab.deleteLinkedMessages(s, m.ID, deleter)
+}
+
+// handleMessageDeleteBulk processes bulk message deletions and propagates them to the linked copies in the hub
+func (ab *AgoraBot) handleMessageDeleteBulk(s *discordgo.Session, m *discordgo.MessageDeleteBulk) {
+	deleter := ab.auditLogDeleter(s, m.GuildID, m.ChannelID, discordgo.AuditLogActionMessageBulkDelete)
+	for _, messageID := range m.Messages {
+		ab.deleteLinkedMessages(s, messageID, deleter)
+	}
+}
+
+// handleReactionAdd processes reaction additions and relays them to the other channels in the same hub
+func (ab *AgoraBot) handleReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
 	// Ignore reactions from the bot itself
 	if r.UserID == s.State.User.ID {
 		return
 	}
 
-	// Check if message channel is in any hub
-	h, errHub := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: r.ChannelID})
+	// Check if message channel is in any hub, or is a thread mirrored across one
+	h, targets, errHub := ab.channelHub(s, r.ChannelID)
 	if errHub != nil {
-		log.Printf("Error getting hub of channel: %v\n", errHub)
+		if !errors.Is(errHub, store.ErrNotFound) {
+			log.Printf("Error getting hub of channel: %v\n", errHub)
+		}
 		return
 	}
 
-	// Get the user who removed the reaction
-	user, err := s.User(r.UserID)
-	if err != nil {
-		log.Printf("Error getting user: %v\n", err)
+	switch h.Settings.Reactions() {
+	case hub.ReactionModeAnnounce:
+		ab.announceReaction(s, h, targets, r.MessageReaction, true)
+	case hub.ReactionModeDigest:
+		ab.digestReaction(s, r.MessageReaction, true)
+	default:
+		ab.mirrorReaction(s, r.MessageReaction, true)
+	}
+}
+
+// handleReactionRemove processes reaction removals and relays them to the other channels in the same hub
+func (ab *AgoraBot) handleReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	// Ignore reactions from the bot itself
+	if r.UserID == s.State.User.ID {
 		return
 	}
 
-	// Echo reaction removal to other channels in the hub
-	for _, targetChannelID := range h.Channels {
-		if targetChannelID != r.ChannelID {
-			// Create message about the reaction removal
-			messageLink := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", r.GuildID, r.ChannelID, r.MessageID)
-			content := fmt.Sprintf("**%s** removed their %s reaction from [a message](%s) in <#%s>",
-				user.Username,
-				r.Emoji.MessageFormat(),
-				messageLink,
-				r.ChannelID,
-			)
-
-			_, err := s.ChannelMessageSend(targetChannelID, content)
-			if err != nil {
-				log.Printf("Error sending message: %v\n", err)
-			}
+	// Check if message channel is in any hub, or is a thread mirrored across one
+	h, targets, errHub := ab.channelHub(s, r.ChannelID)
+	if errHub != nil {
+		if !errors.Is(errHub, store.ErrNotFound) {
+			log.Printf("Error getting hub of channel: %v\n", errHub)
 		}
+		return
+	}
+
+	switch h.Settings.Reactions() {
+	case hub.ReactionModeAnnounce:
+		ab.announceReaction(s, h, targets, r.MessageReaction, false)
+	case hub.ReactionModeDigest:
+		ab.digestReaction(s, r.MessageReaction, false)
+	default:
+		ab.mirrorReaction(s, r.MessageReaction, false)
 	}
 }
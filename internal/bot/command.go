@@ -0,0 +1,337 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxListedHubs is the number of hubs /hub list shows, an embed holding at most 25 fields.
+const maxListedHubs = 25
+
+var noDMs = false
+
+// hubOption is the option of the subcommands acting on an existing hub.
+var hubOption = &discordgo.ApplicationCommandOption{
+	Type:         discordgo.ApplicationCommandOptionString,
+	Name:         "hub",
+	Description:  "Name of the hub",
+	Required:     true,
+	Autocomplete: true,
+}
+
+// hubCommand manages hubs from Discord.
+var hubCommand = &discordgo.ApplicationCommand{
+	Name:         "hub",
+	Description:  "Manage the hubs linking channels across servers",
+	DMPermission: &noDMs,
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "create",
+			Description: "Create a hub owned by you",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "name",
+					Description: "Name of the hub",
+					Required:    true,
+					MaxLength:   100,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "description",
+					Description: "What the hub is about",
+					MaxLength:   300,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "public",
+					Description: "Whether anyone can find and join the hub, only its moderators can by default",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "delete",
+			Description: "Delete a hub you own",
+			Options:     []*discordgo.ApplicationCommandOption{hubOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "info",
+			Description: "Show the details of a hub",
+			Options:     []*discordgo.ApplicationCommandOption{hubOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "join",
+			Description: "Link this channel to a hub",
+			Options:     []*discordgo.ApplicationCommandOption{hubOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "leave",
+			Description: "Unlink this channel from its hub",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "settings",
+			Description: "Open the settings panel of a hub you moderate",
+			Options:     []*discordgo.ApplicationCommandOption{hubOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "deadletters",
+			Description: "Inspect and replay the failed deliveries of a hub you own",
+			Options:     []*discordgo.ApplicationCommandOption{hubOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "List the hubs you manage and the hubs of this server",
+		},
+	},
+}
+
+// handleHubCommand runs a subcommand of /hub
+func (ab *AgoraBot) handleHubCommand(s *discordgo.Session, i *discordgo.InteractionCreate, data discordgo.ApplicationCommandInteractionData) {
+	if len(data.Options) == 0 {
+		return
+	}
+	sub := data.Options[0]
+	options := optionMap(sub.Options)
+
+	switch sub.Name {
+	case "create":
+		description := ""
+		if option, ok := options["description"]; ok {
+			description = option.StringValue()
+		}
+		public := false
+		if option, ok := options["public"]; ok {
+			public = option.BoolValue()
+		}
+		ab.createHub(s, i, options["name"].StringValue(), description, public)
+	case "delete":
+		ab.deleteHub(s, i, options["hub"].StringValue())
+	case "info":
+		ab.showHub(s, i, options["hub"].StringValue())
+	case "join":
+		ab.joinHub(s, i, options["hub"].StringValue())
+	case "leave":
+		ab.leaveHub(s, i)
+	case "settings":
+		ab.openSettings(s, i, options["hub"].StringValue())
+	case "deadletters":
+		ab.openDeadLetters(s, i, options["hub"].StringValue())
+	case "list":
+		ab.listHubs(s, i)
+	}
+}
+
+// findHub returns the hub referred to by an option of a command, by name or by the ID suggested by autocompletion.
+func (ab *AgoraBot) findHub(value string) (hub.Hub, error) {
+	value = strings.TrimSpace(value)
+	h, errName := queries.GetHubByNameQuery{}.Do(ab.GetQueryDeps(), store.GetHubByNameParams{Name: value})
+	if !errors.Is(errName, store.ErrNotFound) {
+		return h, errName
+	}
+
+	id, errID := primitive.ObjectIDFromHex(value)
+	if errID != nil {
+		return hub.Hub{}, errName
+	}
+	return queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: id})
+}
+
+// respondHubError replies with the reason a hub couldn't be found.
+func respondHubError(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(s, i, "This hub doesn't exist.")
+		return
+	}
+	log.Printf("Error getting hub: %v\n", err)
+	respondError(s, i, "The hub couldn't be loaded, please try again later.")
+}
+
+// respondQueryError replies with the reason a query refused a change,
+// or with a failure message when the change failed for another reason.
+func respondQueryError(s *discordgo.Session, i *discordgo.InteractionCreate, err error, failure string) {
+	switch {
+	case errors.Is(err, queries.ErrNameTaken):
+		respondError(s, i, "A hub with this name already exists, please choose another one.")
+	case errors.Is(err, queries.ErrEmptyName):
+		respondError(s, i, "The name of a hub can't be empty.")
+	case errors.Is(err, queries.ErrMaxHubs):
+		respondError(s, i, "The maximum number of hubs is reached, no hub can be created for now.")
+	case errors.Is(err, queries.ErrMaxChannels):
+		respondError(s, i, "This hub has reached its maximum number of channels.")
+	case errors.Is(err, store.ErrNotFound):
+		respondError(s, i, "This hub doesn't exist.")
+	default:
+		respondError(s, i, failure)
+	}
+}
+
+func (ab *AgoraBot) createHub(s *discordgo.Session, i *discordgo.InteractionCreate, name string, description string, public bool) {
+	h := hub.Hub{
+		ID:          primitive.NewObjectID(),
+		OwnerID:     interactionUser(i).ID,
+		Name:        strings.TrimSpace(name),
+		Description: strings.TrimSpace(description),
+		Channels:    []string{},
+		Moderators:  []string{},
+		Settings:    hub.Settings{Public: public},
+	}
+
+	_, errAdd := queries.AddHubQuery{}.Do(ab.GetQueryDeps(), store.AddHubParams{Hub: h})
+	if errAdd != nil {
+		log.Printf("Error creating hub: %v\n", errAdd)
+		respondQueryError(s, i, errAdd, "The hub couldn't be created, please try again later.")
+		return
+	}
+
+	respondEmbed(s, i, &discordgo.MessageEmbed{
+		Title:       "Hub created",
+		Description: fmt.Sprintf("**%s** is ready, channels can now join it with `/hub join`.", h.Name),
+		Color:       colorInfo,
+	})
+}
+
+func (ab *AgoraBot) deleteHub(s *discordgo.Session, i *discordgo.InteractionCreate, value string) {
+	h, errHub := ab.findHub(value)
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+
+	if h.OwnerID != interactionUser(i).ID {
+		respondError(s, i, "Only the owner of a hub can delete it.")
+		return
+	}
+
+	_, errDelete := queries.DeleteHubQuery{}.Do(ab.GetQueryDeps(), store.DeleteHubParams{ID: h.ID})
+	if errDelete != nil {
+		log.Printf("Error deleting hub: %v\n", errDelete)
+		respondError(s, i, "The hub couldn't be deleted, please try again later.")
+		return
+	}
+
+	respondEmbed(s, i, &discordgo.MessageEmbed{
+		Title:       "Hub deleted",
+		Description: fmt.Sprintf("**%s** was deleted, its channels are no longer linked.", h.Name),
+		Color:       colorInfo,
+	})
+}
+
+func (ab *AgoraBot) showHub(s *discordgo.Session, i *discordgo.InteractionCreate, value string) {
+	h, errHub := ab.findHub(value)
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+	if !canSeeHub(s, h, interactionUser(i).ID, i.GuildID) {
+		respondHubError(s, i, fmt.Errorf("hub %s %w", value, store.ErrNotFound))
+		return
+	}
+
+	respondEmbed(s, i, hubEmbed(h))
+}
+
+// hubEmbed describes a hub.
+func hubEmbed(h hub.Hub) *discordgo.MessageEmbed {
+	channels := "None yet"
+	if len(h.Channels) > 0 {
+		mentions := make([]string, len(h.Channels))
+		for i, channelID := range h.Channels {
+			mentions[i] = fmt.Sprintf("<#%s>", channelID)
+		}
+		channels = strings.Join(mentions, "\n")
+	}
+
+	moderators := "None"
+	if len(h.Moderators) > 0 {
+		mentions := make([]string, len(h.Moderators))
+		for i, userID := range h.Moderators {
+			mentions[i] = fmt.Sprintf("<@%s>", userID)
+		}
+		moderators = strings.Join(mentions, ", ")
+	}
+
+	visibility := "Private"
+	if h.Settings.Public {
+		visibility = "Public"
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       h.Name,
+		Description: h.Description,
+		Color:       colorInfo,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Owner", Value: fmt.Sprintf("<@%s>", h.OwnerID), Inline: true},
+			{Name: "Moderators", Value: moderators, Inline: true},
+			{Name: "Reactions", Value: string(h.Settings.Reactions()), Inline: true},
+			{Name: "Visibility", Value: visibility, Inline: true},
+			{Name: fmt.Sprintf("Channels (%d)", len(h.Channels)), Value: channels},
+		},
+		Footer: &discordgo.MessageEmbedFooter{Text: "ID " + h.ID.Hex()},
+	}
+}
+
+func (ab *AgoraBot) listHubs(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	hubs, errHubs := queries.GetHubsQuery{}.Do(ab.GetQueryDeps(), store.GetHubsParams{})
+	if errHubs != nil {
+		log.Printf("Error getting hubs: %v\n", errHubs)
+		respondError(s, i, "The hubs couldn't be loaded, please try again later.")
+		return
+	}
+
+	userID := interactionUser(i).ID
+	embed := &discordgo.MessageEmbed{
+		Title: "Hubs",
+		Color: colorInfo,
+	}
+
+	listed := 0
+	for _, h := range hubs {
+		if !h.IsModerator(userID) && !hasChannelInGuild(s, h, i.GuildID) {
+			continue
+		}
+
+		listed++
+		if listed > maxListedHubs {
+			continue
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  h.Name,
+			Value: fmt.Sprintf("`%s` · %d channels", h.ID.Hex(), len(h.Channels)),
+		})
+	}
+
+	switch {
+	case listed == 0:
+		embed.Description = "You don't manage any hub and this server isn't in any hub. Create one with `/hub create`."
+	case listed > maxListedHubs:
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("and %d more", listed-maxListedHubs)}
+	}
+
+	respondEmbed(s, i, embed)
+}
+
+// hasChannelInGuild reports whether one of the channels of the hub belongs to the guild.
+func hasChannelInGuild(s *discordgo.Session, h hub.Hub, guildID string) bool {
+	for _, channelID := range h.Channels {
+		if channel, errChannel := s.State.Channel(channelID); errChannel == nil && channel.GuildID == guildID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/deadletter"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Handler names of the components of the dead letters panel, their custom IDs ending with the ID of the hub.
+const (
+	deadLettersReplayID    = "deadletters-replay"
+	deadLettersReplayAllID = "deadletters-replay-all"
+)
+
+// maxDeadLetterError is the length the errors of dead letters are shortened to in the panel.
+const maxDeadLetterError = 100
+
+func (ab *AgoraBot) openDeadLetters(s *discordgo.Session, i *discordgo.InteractionCreate, value string) {
+	h, errHub := ab.findHub(value)
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+	if h.OwnerID != interactionUser(i).ID {
+		respondError(s, i, "Only the owner of a hub can inspect its failed deliveries.")
+		return
+	}
+
+	data, errPanel := ab.deadLettersPanel(h, "")
+	if errPanel != nil {
+		log.Printf("Error getting dead letters: %v\n", errPanel)
+		respondError(s, i, "The failed deliveries couldn't be loaded, please try again later.")
+		return
+	}
+
+	errRespond := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if errRespond != nil {
+		log.Printf("Error responding to interaction: %v\n", errRespond)
+	}
+}
+
+// hubDeadLetters returns the dead letters of a hub, oldest first.
+func (ab *AgoraBot) hubDeadLetters(hubID primitive.ObjectID) ([]deadletter.DeadLetter, error) {
+	letters, errLetters := queries.GetDeadLettersQuery{}.Do(ab.GetQueryDeps(), store.GetDeadLettersParams{HubID: hubID})
+	if errLetters != nil {
+		return nil, errLetters
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].CreatedAt.Before(letters[j].CreatedAt)
+	})
+	return letters, nil
+}
+
+// deadLettersPanel lists the dead letters of a hub with the components replaying them, after an optional notice.
+func (ab *AgoraBot) deadLettersPanel(h hub.Hub, notice string) (*discordgo.InteractionResponseData, error) {
+	letters, errLetters := ab.hubDeadLetters(h.ID)
+	if errLetters != nil {
+		return nil, errLetters
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: "Failed deliveries of " + h.Name,
+		Color: colorInfo,
+	}
+	data := &discordgo.InteractionResponseData{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: []discordgo.MessageComponent{},
+		Flags:      discordgo.MessageFlagsEphemeral,
+	}
+
+	var lines []string
+	if notice != "" {
+		lines = append(lines, notice, "")
+	}
+	if len(letters) == 0 {
+		embed.Description = strings.Join(append(lines, "Every delivery succeeded."), "\n")
+		return data, nil
+	}
+
+	shown := letters
+	if len(shown) > maxSelectOptions {
+		shown = shown[:maxSelectOptions]
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("and %d more, shown once these are handled", len(letters)-maxSelectOptions)}
+	}
+
+	options := make([]discordgo.SelectMenuOption, len(shown))
+	for n, dl := range shown {
+		lines = append(lines, fmt.Sprintf("`%d.` %s of [a message](https://discord.com/channels/%s/%s/%s) to <#%s>, %d attempts <t:%d:R>",
+			n+1, dl.Kind, dl.OriginGuildID, dl.OriginChannelID, dl.OriginMessageID, dl.ChannelID, dl.Attempts, dl.CreatedAt.Unix()))
+
+		options[n] = discordgo.SelectMenuOption{
+			Label:       fmt.Sprintf("%d. %s to channel %s", n+1, dl.Kind, dl.ChannelID),
+			Value:       dl.ID.Hex(),
+			Description: shorten(dl.Error, maxDeadLetterError),
+		}
+	}
+	embed.Description = strings.Join(lines, "\n")
+
+	id := h.ID.Hex()
+	data.Components = []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				CustomID:    customID(deadLettersReplayID, id),
+				Placeholder: "Replay deliveries",
+				MaxValues:   len(options),
+				Options:     options,
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Replay all",
+				Style:    discordgo.PrimaryButton,
+				CustomID: customID(deadLettersReplayAllID, id),
+			},
+		}},
+	}
+	return data, nil
+}
+
+// shorten cuts a text to a maximum number of characters, marking the cut with an ellipsis.
+func shorten(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+func (ab *AgoraBot) replayDeadLetters(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	selected := make(map[string]bool)
+	for _, value := range i.MessageComponentData().Values {
+		selected[value] = true
+	}
+	ab.replay(s, i, args, func(dl deadletter.DeadLetter) bool {
+		return selected[dl.ID.Hex()]
+	})
+}
+
+func (ab *AgoraBot) replayAllDeadLetters(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	ab.replay(s, i, args, func(dl deadletter.DeadLetter) bool {
+		return true
+	})
+}
+
+// replay replays the dead letters of the hub of a panel interaction matching a filter, and refreshes the panel.
+// Replaying fetches the original messages again, so the response is deferred.
+func (ab *AgoraBot) replay(s *discordgo.Session, i *discordgo.InteractionCreate, args []string, filter func(deadletter.DeadLetter) bool) {
+	if len(args) == 0 {
+		return
+	}
+	hubID, errID := primitive.ObjectIDFromHex(args[0])
+	if errID != nil {
+		log.Printf("Error parsing hub ID of interaction: %v\n", errID)
+		return
+	}
+
+	h, errHub := queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: hubID})
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+	if h.OwnerID != interactionUser(i).ID {
+		respondError(s, i, "Only the owner of a hub can replay its failed deliveries.")
+		return
+	}
+
+	errDefer := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if errDefer != nil {
+		log.Printf("Error responding to interaction: %v\n", errDefer)
+		return
+	}
+
+	letters, errLetters := ab.hubDeadLetters(h.ID)
+	if errLetters != nil {
+		log.Printf("Error getting dead letters: %v\n", errLetters)
+		letters = nil
+	}
+
+	replayed, failed := 0, 0
+	for _, dl := range letters {
+		if !filter(dl) {
+			continue
+		}
+		if errReplay := ab.replayDeadLetter(s, dl); errReplay != nil {
+			log.Printf("Error replaying dead letter %s: %v\n", dl.ID.Hex(), errReplay)
+			failed++
+			continue
+		}
+		replayed++
+	}
+
+	notice := fmt.Sprintf("%d deliveries queued again, the ones failing again will be listed here.", replayed)
+	if failed > 0 {
+		notice += fmt.Sprintf(" %d couldn't be replayed, their original message may have been deleted.", failed)
+	}
+
+	data, errPanel := ab.deadLettersPanel(h, notice)
+	if errPanel != nil {
+		log.Printf("Error getting dead letters: %v\n", errPanel)
+		return
+	}
+	_, errEdit := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &data.Embeds,
+		Components: &data.Components,
+	})
+	if errEdit != nil {
+		log.Printf("Error updating interaction response: %v\n", errEdit)
+	}
+}
@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/deadletter"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// deliveryOptions are the request options of the deliveries made by the dispatcher,
+// which handles rate limits and retries itself so that waiting deliveries don't hold a worker.
+var deliveryOptions = []discordgo.RequestOption{
+	discordgo.WithRetryOnRatelimit(false),
+	discordgo.WithRestRetries(0),
+}
+
+const (
+	// minRetryDelay is the delay before the first retry of a delivery failing with a transient error.
+	minRetryDelay = time.Second
+	// maxRetryDelay caps the exponential backoff of deliveries failing with transient errors.
+	maxRetryDelay = 30 * time.Second
+)
+
+// retryDelivery is the retry policy of the dispatcher.
+// Rate limited deliveries are retried after the delay given by Discord, and deliveries failing
+// with server or network errors are retried with an exponential backoff.
+// Other errors, such as missing permissions, unknown channels or deleted webhooks, are permanent.
+func (ab *AgoraBot) retryDelivery(err error, attempts int) (time.Duration, bool) {
+	if attempts >= ab.Conf.DeliveryMaxAttempts {
+		return 0, false
+	}
+
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.RetryAfter, true
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) {
+		if restErr.Response == nil || restErr.Response.StatusCode < http.StatusInternalServerError {
+			return 0, false
+		}
+	} else if !isNetworkError(err) {
+		return 0, false
+	}
+
+	delay := minRetryDelay << (attempts - 1)
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay, true
+}
+
+// isNetworkError reports whether err was caused by a request which didn't get a response in time or at all.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// logFailure returns a failure handler logging the given description of a delivery.
+func logFailure(format string, args ...interface{}) func(error, int) {
+	description := fmt.Sprintf(format, args...)
+	return func(err error, attempts int) {
+		log.Printf("Error %s after %d attempts: %v\n", description, attempts, err)
+	}
+}
+
+// deadLetter returns a failure handler recording a failed delivery of an original message in the dead letter store.
+// Part is the first part of the copy which wasn't sent, so that a replay doesn't send the others again.
+func (ab *AgoraBot) deadLetter(kind deadletter.Kind, hubID primitive.ObjectID, channelID string, m *discordgo.Message, part int) func(error, int) {
+	return func(err error, attempts int) {
+		log.Printf("Error delivering %s of message %s to channel %s after %d attempts: %v\n", kind, m.ID, channelID, attempts, err)
+
+		_, errAdd := queries.AddDeadLetterQuery{}.Do(ab.GetQueryDeps(), store.AddDeadLetterParams{
+			DeadLetter: deadletter.DeadLetter{
+				HubID:           hubID,
+				Kind:            kind,
+				ChannelID:       channelID,
+				OriginChannelID: m.ChannelID,
+				OriginGuildID:   m.GuildID,
+				OriginMessageID: m.ID,
+				Part:            part,
+				Error:           err.Error(),
+				Attempts:        attempts,
+				CreatedAt:       time.Now(),
+			},
+		})
+		if errAdd != nil {
+			log.Printf("Error recording dead letter: %v\n", errAdd)
+		}
+	}
+}
+
+// replayDeadLetter delivers again a delivery recorded in the dead letter store, removing it from the store.
+// The original message is fetched again, so that the delivery reflects its current state,
+// and a relay resumes from the part which failed.
+// If the delivery fails again, it is recorded as a new dead letter.
+func (ab *AgoraBot) replayDeadLetter(s *discordgo.Session, dl deadletter.DeadLetter) error {
+	h, errHub := queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: dl.HubID})
+	if errHub != nil {
+		return errHub
+	}
+
+	m, errMessage := s.ChannelMessage(dl.OriginChannelID, dl.OriginMessageID)
+	if errMessage != nil {
+		return fmt.Errorf("error getting message %s: %w", dl.OriginMessageID, errMessage)
+	}
+	m.GuildID = dl.OriginGuildID
+
+	_, errDelete := queries.DeleteDeadLetterQuery{}.Do(ab.GetQueryDeps(), store.DeleteDeadLetterParams{ID: dl.ID})
+	if errDelete != nil {
+		return errDelete
+	}
+
+	switch dl.Kind {
+	case deadletter.KindMessage:
+		ab.enqueueRelay(s, h, dl.ChannelID, ab.newRelay(h, m, true), true, dl.Part)
+	case deadletter.KindEdit:
+		ab.enqueueEdit(s, h, dl.ChannelID, ab.newRelay(h, m, false))
+	default:
+		return fmt.Errorf("unknown dead letter kind %s", dl.Kind)
+	}
+
+	return nil
+}
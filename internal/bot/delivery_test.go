@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/config"
+)
+
+func restError(status int, code int) error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: status},
+		Message:  &discordgo.APIErrorMessage{Code: code},
+	}
+}
+
+func TestRetryDelivery(t *testing.T) {
+	ab := &AgoraBot{Conf: config.Config{DeliveryMaxAttempts: 10}}
+
+	tests := []struct {
+		name      string
+		err       error
+		attempts  int
+		wantRetry bool
+		wantDelay time.Duration
+	}{
+		{name: "rate limit", err: &discordgo.RateLimitError{RateLimit: &discordgo.RateLimit{TooManyRequests: &discordgo.TooManyRequests{RetryAfter: 3 * time.Second}}}, attempts: 1, wantRetry: true, wantDelay: 3 * time.Second},
+		{name: "server error", err: restError(http.StatusBadGateway, 0), attempts: 1, wantRetry: true, wantDelay: minRetryDelay},
+		{name: "backoff", err: restError(http.StatusInternalServerError, 0), attempts: 3, wantRetry: true, wantDelay: 4 * minRetryDelay},
+		{name: "backoff cap", err: restError(http.StatusServiceUnavailable, 0), attempts: 7, wantRetry: true, wantDelay: maxRetryDelay},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, attempts: 1, wantRetry: true, wantDelay: minRetryDelay},
+		{name: "timeout", err: fmt.Errorf("failed to get webhook: %w", context.DeadlineExceeded), attempts: 1, wantRetry: true, wantDelay: minRetryDelay},
+		{name: "wrapped server error", err: fmt.Errorf("error editing message: %w", restError(http.StatusInternalServerError, 0)), attempts: 1, wantRetry: true, wantDelay: minRetryDelay},
+		{name: "missing permissions", err: restError(http.StatusForbidden, discordgo.ErrCodeMissingPermissions), attempts: 1},
+		{name: "unknown channel", err: restError(http.StatusNotFound, discordgo.ErrCodeUnknownChannel), attempts: 1},
+		{name: "rest error without response", err: &discordgo.RESTError{}, attempts: 1},
+		{name: "deleted webhook", err: errors.New("webhook 1 of message 2 no longer exists"), attempts: 1},
+		{name: "last attempt", err: restError(http.StatusInternalServerError, 0), attempts: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := ab.retryDelivery(tt.err, tt.attempts)
+			if retry != tt.wantRetry {
+				t.Fatalf("retryDelivery(%v) retries: %t, want %t", tt.err, retry, tt.wantRetry)
+			}
+			if retry && delay != tt.wantDelay {
+				t.Errorf("retryDelivery(%v) = %v, want %v", tt.err, delay, tt.wantDelay)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// digestPrefix starts the footer of the embed summarizing the reactions to a message.
+const digestPrefix = "Reactions across the hub: "
+
+// reactionDigester batches the reaction changes of each message over a window before their summary is updated.
+type reactionDigester struct {
+	mu      sync.Mutex
+	window  time.Duration
+	pending map[string]struct{}
+}
+
+func newReactionDigester(window time.Duration) *reactionDigester {
+	return &reactionDigester{
+		window:  window,
+		pending: make(map[string]struct{}),
+	}
+}
+
+// schedule runs flush once the window is over, unless it is already scheduled for the message.
+func (d *reactionDigester) schedule(originMessageID string, flush func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pending[originMessageID]; ok {
+		return
+	}
+	d.pending[originMessageID] = struct{}{}
+
+	time.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		delete(d.pending, originMessageID)
+		d.mu.Unlock()
+
+		flush()
+	})
+}
+
+// digestReaction records a reaction change and schedules the update of the summary of the message's reactions.
+func (ab *AgoraBot) digestReaction(s *discordgo.Session, r *discordgo.MessageReaction, added bool) {
+	l, _, ok := ab.recordReaction(r, added)
+	if !ok {
+		return
+	}
+
+	ab.scheduleDigest(s, l.OriginMessageID)
+}
+
+// scheduleDigest schedules the update of the summary of the reactions to a linked message.
+func (ab *AgoraBot) scheduleDigest(s *discordgo.Session, originMessageID string) {
+	ab.digests.schedule(originMessageID, func() {
+		ab.updateDigest(s, originMessageID)
+	})
+}
+
+// updateDigest shows the current reactions to a linked message in the footer of an embed of every mirror.
+// The original message belongs to its author, its guild only sees the reactions made there.
+func (ab *AgoraBot) updateDigest(s *discordgo.Session, originMessageID string) {
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: originMessageID})
+	if errLink != nil {
+		if !errors.Is(errLink, store.ErrNotFound) {
+			log.Printf("Error getting message link: %v\n", errLink)
+		}
+		return
+	}
+
+	reactions, errReactions := queries.GetReactionsQuery{}.Do(ab.GetQueryDeps(), store.GetReactionsParams{OriginMessageID: originMessageID})
+	if errReactions != nil {
+		log.Printf("Error getting reactions: %v\n", errReactions)
+		return
+	}
+	summary := digestSummary(reactions)
+
+	for _, mirror := range l.Mirrors {
+		if mirror.Part != 0 {
+			continue
+		}
+
+		mirror := mirror
+		ab.dispatcher.Enqueue(mirror.ChannelID, func() error {
+			return ab.setDigest(s, mirror, summary)
+		}, logFailure("updating reactions of message %s in channel %s", mirror.MessageID, mirror.ChannelID))
+	}
+}
+
+// digestSummary lists the emojis reacted with and their counts, most used first.
+// It returns an empty summary when nobody reacts to the message.
+func digestSummary(reactions []link.Reaction) string {
+	sort.Slice(reactions, func(i, j int) bool {
+		if len(reactions[i].UserIDs) != len(reactions[j].UserIDs) {
+			return len(reactions[i].UserIDs) > len(reactions[j].UserIDs)
+		}
+		return reactions[i].Emoji < reactions[j].Emoji
+	})
+
+	var counts []string
+	for _, reaction := range reactions {
+		if len(reaction.UserIDs) == 0 {
+			continue
+		}
+		counts = append(counts, fmt.Sprintf("%s %d", digestEmoji(reaction.Emoji), len(reaction.UserIDs)))
+	}
+	return strings.Join(counts, " · ")
+}
+
+// digestEmoji returns a readable form of an emoji in the API format, custom emojis not rendering in footers.
+func digestEmoji(emoji string) string {
+	name, _, custom := strings.Cut(emoji, ":")
+	if custom {
+		return ":" + name + ":"
+	}
+	return emoji
+}
+
+// isDigest reports whether an embed is the reaction summary added by the bot.
+func isDigest(embed *discordgo.MessageEmbed) bool {
+	return embed.Footer != nil && strings.HasPrefix(embed.Footer.Text, digestPrefix) &&
+		embed.Title == "" && embed.Description == "" && len(embed.Fields) == 0
+}
+
+// withDigest replaces the reaction summary among the embeds of a message, removing it when the summary is empty.
+// Link previews are left out, Discord generating them again from the content.
+func withDigest(embeds []*discordgo.MessageEmbed, summary string) []*discordgo.MessageEmbed {
+	kept := []*discordgo.MessageEmbed{}
+	for _, embed := range embeds {
+		if embed.Type == discordgo.EmbedTypeRich && !isDigest(embed) {
+			kept = append(kept, embed)
+		}
+	}
+
+	if summary == "" || len(kept) >= maxEmbeds {
+		return kept
+	}
+	return append(kept, &discordgo.MessageEmbed{
+		Footer: &discordgo.MessageEmbedFooter{Text: digestPrefix + summary},
+	})
+}
+
+// setDigest updates the reaction summary of a mirror, keeping its other embeds.
+func (ab *AgoraBot) setDigest(s *discordgo.Session, mirror link.Mirror, summary string) error {
+	current, errMessage := s.ChannelMessage(mirror.ChannelID, mirror.MessageID, deliveryOptions...)
+	if errMessage != nil {
+		return errMessage
+	}
+	embeds := withDigest(current.Embeds, summary)
+
+	if mirror.WebhookID == "" {
+		_, errEdit := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:      mirror.MessageID,
+			Channel: mirror.ChannelID,
+			Embeds:  &embeds,
+		}, deliveryOptions...)
+		return errEdit
+	}
+
+	parentID, threadID := webhookChannel(s, mirror.ChannelID)
+	wh, errWebhook := queries.GetWebhookQuery{}.Do(ab.GetQueryDeps(), store.GetWebhookParams{ChannelID: parentID})
+	if errWebhook != nil {
+		return errWebhook
+	}
+	if wh.ID != mirror.WebhookID {
+		return fmt.Errorf("webhook %s of message %s no longer exists", mirror.WebhookID, mirror.MessageID)
+	}
+
+	return webhookMessageEdit(s, wh, threadID, mirror.MessageID, &discordgo.WebhookEdit{
+		Embeds: &embeds,
+	})
+}
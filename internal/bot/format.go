@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/format"
+	"github.com/maaxleq/agora-bot/internal/hub"
+)
+
+// formatVars returns the format variables describing an author in a channel of the hub.
+func formatVars(s *discordgo.Session, h hub.Hub, author string, channelID string) format.Vars {
+	vars := format.Vars{
+		Author:  author,
+		Channel: "unknown-channel",
+		Hub:     h.Name,
+	}
+
+	channel, errChannel := s.State.Channel(channelID)
+	if errChannel != nil {
+		return vars
+	}
+	vars.Channel = channel.Name
+
+	if guild, errGuild := s.State.Guild(channel.GuildID); errGuild == nil {
+		vars.Guild = guild.Name
+	}
+	return vars
+}
+
+// renderFormat renders a format of the hub, falling back to the default format when it fails.
+// Formats are validated when saved, so failures only come from unexpected variables, such as over-long names.
+func renderFormat(text string, fallback string, vars format.Vars) string {
+	rendered, errRender := format.Render(text, vars)
+	if errRender == nil {
+		return rendered
+	}
+	log.Printf("Error rendering format: %v\n", errRender)
+
+	rendered, errRender = format.Render(fallback, vars)
+	if errRender != nil {
+		log.Printf("Error rendering default format: %v\n", errRender)
+	}
+	return rendered
+}
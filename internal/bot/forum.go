@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// isForum reports whether messages can only be posted in threads of the channel, as in forum and media channels.
+func isForum(channel *discordgo.Channel) bool {
+	return channel.Type == discordgo.ChannelTypeGuildForum || channel.Type == discordgo.ChannelTypeGuildMedia
+}
+
+// isForumChannel reports whether the channel with the given ID is a forum or media channel.
+func isForumChannel(s *discordgo.Session, channelID string) bool {
+	channel, errChannel := getChannel(s, channelID)
+	return errChannel == nil && isForum(channel)
+}
+
+// forumTags maps the tags applied to a forum post to the tags of the target forum having the same names.
+func forumTags(s *discordgo.Session, post *discordgo.Channel, target *discordgo.Channel) []string {
+	origin, errOrigin := getChannel(s, post.ParentID)
+	if errOrigin != nil || !isForum(origin) {
+		return nil
+	}
+
+	names := make(map[string]string)
+	for _, tag := range origin.AvailableTags {
+		names[tag.ID] = tag.Name
+	}
+
+	tags := []string{}
+	for _, tagID := range post.AppliedTags {
+		for _, tag := range target.AvailableTags {
+			if strings.EqualFold(tag.Name, names[tagID]) {
+				tags = append(tags, tag.ID)
+				break
+			}
+		}
+	}
+	return tags
+}
+
+// startForumPost mirrors a thread as a post of the target forum, whose first message is the copy of the thread's starter message.
+// Threads without a starter message are announced by the bot instead. It returns the ID of the created post.
+func (ab *AgoraBot) startForumPost(s *discordgo.Session, t *discordgo.Channel, rl *relay, target *discordgo.Channel) (string, error) {
+	thread := &discordgo.ThreadStart{
+		Name:        t.Name,
+		AppliedTags: forumTags(s, t, target),
+	}
+	if t.ThreadMetadata != nil {
+		thread.AutoArchiveDuration = t.ThreadMetadata.AutoArchiveDuration
+	}
+
+	if rl == nil {
+		post, errPost := s.ForumThreadStartComplex(target.ID, thread, &discordgo.MessageSend{
+			Content:         fmt.Sprintf("Thread started in %s", channelLabel(s, t.ParentID)),
+			AllowedMentions: noMentions(),
+		}, deliveryOptions...)
+		if errPost != nil {
+			return "", errPost
+		}
+		return post.ID, nil
+	}
+
+	first, errFirst := ab.postStarterMessage(s, thread, rl, target)
+	if errFirst != nil {
+		return "", errFirst
+	}
+	ab.addMirror(s, rl, first, 0)
+
+	// The rest of an over-length starter message follows inside the post
+	sent, errSend := ab.relayMessage(s, first.ChannelID, rl, 1)
+	for i, msg := range sent {
+		ab.addMirror(s, rl, msg, i+1)
+	}
+	if errSend != nil {
+		log.Printf("Error relaying starter message of post %s: %v\n", first.ChannelID, errSend)
+	}
+
+	return first.ChannelID, nil
+}
+
+// postStarterMessage creates a forum post whose first message is the first part of the relayed message.
+// The post is created through the forum's webhook to impersonate the original author,
+// falling back to a post of the bot when the bot cannot use webhooks in that forum.
+func (ab *AgoraBot) postStarterMessage(s *discordgo.Session, thread *discordgo.ThreadStart, rl *relay, target *discordgo.Channel) (*discordgo.Message, error) {
+	wh, errWebhook := ab.getWebhook(s, target.ID)
+	if errWebhook == nil {
+		p := ab.buildPayload(s, target.ID, rl, false)
+		msg, errExec := webhookExecute(s, wh, "", &discordgo.WebhookParams{
+			Content:         p.parts()[0],
+			Embeds:          p.Embeds,
+			Files:           p.Files,
+			AllowedMentions: p.AllowedMentions,
+			Username:        ab.webhookUsername(s, rl.message),
+			AvatarURL:       authorAvatarURL(rl.message),
+			ThreadName:      thread.Name,
+		}, p.Attachments)
+		if errExec == nil {
+			// Webhooks cannot apply tags when creating a post
+			if len(thread.AppliedTags) > 0 {
+				_, errTags := s.ChannelEditComplex(msg.ChannelID, &discordgo.ChannelEdit{AppliedTags: &thread.AppliedTags}, deliveryOptions...)
+				if errTags != nil {
+					log.Printf("Error applying tags to post %s: %v\n", msg.ChannelID, errTags)
+				}
+			}
+			return msg, nil
+		}
+		if !isUnknownWebhook(errExec) {
+			return nil, errExec
+		}
+		// The webhook was deleted on Discord, a new one will be created for the next post
+		ab.forgetWebhook(target.ID)
+	} else if !isMissingPermissions(errWebhook) {
+		log.Printf("Error getting webhook of channel %s: %v\n", target.ID, errWebhook)
+	}
+
+	p := ab.buildPayload(s, target.ID, rl, true)
+	post, errPost := forumThreadStart(s, target.ID, thread, &discordgo.MessageSend{
+		Content:         p.parts()[0],
+		Embeds:          p.Embeds,
+		Files:           p.Files,
+		AllowedMentions: p.AllowedMentions,
+	}, p.Attachments)
+	if errPost != nil {
+		return nil, errPost
+	}
+
+	// The starter message of a post shares the ID of the post
+	return &discordgo.Message{ID: post.ID, ChannelID: post.ID}, nil
+}
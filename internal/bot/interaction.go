@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Colors of the embeds the bot replies to interactions with.
+const (
+	colorInfo  = 0x5865f2
+	colorError = 0xed4245
+)
+
+// commands are the application commands registered by the bot.
+var commands = []*discordgo.ApplicationCommand{hubCommand}
+
+// customIDSeparator separates the name of the handler of a component from its arguments in its custom ID.
+const customIDSeparator = ":"
+
+// componentHandler handles a component or modal interaction, args being the rest of its custom ID.
+type componentHandler func(ab *AgoraBot, s *discordgo.Session, i *discordgo.InteractionCreate, args []string)
+
+// componentHandlers route component and modal interactions by the handler name starting their custom ID.
+var componentHandlers = map[string]componentHandler{
+	settingsReactionsID:      (*AgoraBot).setReactionMode,
+	settingsOptionsID:        (*AgoraBot).setRelayOptions,
+	settingsChannelsID:       (*AgoraBot).unlinkChannels,
+	settingsModeratorsID:     (*AgoraBot).setModerators,
+	settingsDetailsID:        (*AgoraBot).editDetails,
+	settingsDetailsModalID:   (*AgoraBot).saveDetails,
+	settingsTemplatesID:      (*AgoraBot).editTemplates,
+	settingsTemplatesModalID: (*AgoraBot).saveTemplates,
+	deadLettersReplayID:      (*AgoraBot).replayDeadLetters,
+	deadLettersReplayAllID:   (*AgoraBot).replayAllDeadLetters,
+}
+
+// customID builds the custom ID of a component or modal routed to a handler with arguments.
+func customID(handler string, args ...string) string {
+	return strings.Join(append([]string{handler}, args...), customIDSeparator)
+}
+
+// registerCommands registers the application commands of the bot, replacing the ones registered before.
+func (ab *AgoraBot) registerCommands(s *discordgo.Session) error {
+	_, errRegister := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", commands)
+	return errRegister
+}
+
+// handleInteraction dispatches interactions to the handlers of the commands
+func (ab *AgoraBot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+		switch data.Name {
+		case hubCommand.Name:
+			ab.handleHubCommand(s, i, data)
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		data := i.ApplicationCommandData()
+		switch data.Name {
+		case hubCommand.Name:
+			ab.handleHubAutocomplete(s, i, data)
+		}
+	case discordgo.InteractionMessageComponent:
+		ab.dispatchComponent(s, i, i.MessageComponentData().CustomID)
+	case discordgo.InteractionModalSubmit:
+		ab.dispatchComponent(s, i, i.ModalSubmitData().CustomID)
+	}
+}
+
+// dispatchComponent runs the handler named by the custom ID of a component or modal.
+func (ab *AgoraBot) dispatchComponent(s *discordgo.Session, i *discordgo.InteractionCreate, id string) {
+	parts := strings.Split(id, customIDSeparator)
+	handler, ok := componentHandlers[parts[0]]
+	if !ok {
+		log.Printf("Error dispatching interaction: no handler for custom ID %s\n", id)
+		return
+	}
+	handler(ab, s, i, parts[1:])
+}
+
+// interactionUser returns the user who triggered an interaction, in a guild or in direct messages.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// optionMap indexes the options of a command by name.
+func optionMap(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	indexed := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		indexed[option.Name] = option
+	}
+	return indexed
+}
+
+// respondEmbed replies to an interaction with an embed only the invoking user can see.
+func respondEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) {
+	errRespond := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if errRespond != nil {
+		log.Printf("Error responding to interaction: %v\n", errRespond)
+	}
+}
+
+// respondUpdate replaces the message holding the component of an interaction.
+func respondUpdate(s *discordgo.Session, i *discordgo.InteractionCreate, data *discordgo.InteractionResponseData) {
+	errRespond := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+	if errRespond != nil {
+		log.Printf("Error responding to interaction: %v\n", errRespond)
+	}
+}
+
+// respondModal replies to an interaction by opening a modal.
+func respondModal(s *discordgo.Session, i *discordgo.InteractionCreate, id string, title string, inputs ...discordgo.TextInput) {
+	rows := make([]discordgo.MessageComponent, len(inputs))
+	for n, input := range inputs {
+		rows[n] = discordgo.ActionsRow{Components: []discordgo.MessageComponent{input}}
+	}
+
+	errRespond := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID:   id,
+			Title:      title,
+			Components: rows,
+		},
+	})
+	if errRespond != nil {
+		log.Printf("Error responding to interaction: %v\n", errRespond)
+	}
+}
+
+// modalValues indexes the values of the text inputs of a submitted modal by custom ID.
+func modalValues(data discordgo.ModalSubmitInteractionData) map[string]string {
+	values := make(map[string]string)
+	for _, row := range data.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actions.Components {
+			if input, ok := component.(*discordgo.TextInput); ok {
+				values[input.CustomID] = input.Value
+			}
+		}
+	}
+	return values
+}
+
+// respondError replies to an interaction with an error only the invoking user can see.
+func respondError(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+	respondEmbed(s, i, &discordgo.MessageEmbed{
+		Description: message,
+		Color:       colorError,
+	})
+}
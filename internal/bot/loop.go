@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+)
+
+// loopDetector remembers the content recently relayed in each hub, so that echoes sent back by other bridges can be recognized.
+type loopDetector struct {
+	mu        sync.Mutex
+	window    time.Duration
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newLoopDetector(window time.Duration) *loopDetector {
+	return &loopDetector{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// fingerprint identifies a content within a hub, ignoring surrounding whitespace.
+func fingerprint(hubID string, content string) string {
+	sum := sha256.Sum256([]byte(hubID + "\x00" + strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+// remember records a content as relayed in a hub.
+func (d *loopDetector) remember(hubID string, content string) {
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.seen[fingerprint(hubID, content)] = now
+
+	// Forget the content older than the window, at most once per window
+	if now.Sub(d.lastPrune) < d.window {
+		return
+	}
+	d.lastPrune = now
+	for key, at := range d.seen {
+		if now.Sub(at) > d.window {
+			delete(d.seen, key)
+		}
+	}
+}
+
+// isDuplicate tells whether a content was relayed in a hub within the window.
+func (d *loopDetector) isDuplicate(hubID string, content string) bool {
+	if strings.TrimSpace(content) == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	at, ok := d.seen[fingerprint(hubID, content)]
+	return ok && time.Since(at) <= d.window
+}
+
+// isBridgeBot tells whether a message comes from one of the bridge bots configured to never be relayed.
+func (ab *AgoraBot) isBridgeBot(m *discordgo.Message) bool {
+	if slices.Contains(ab.Conf.BridgeBotIDs, m.Author.ID) {
+		return true
+	}
+	return m.WebhookID != "" && slices.Contains(ab.Conf.BridgeBotIDs, m.WebhookID)
+}
+
+// shouldRelay applies the loop prevention and the bot and webhook policy of the hub to a message.
+// Messages from humans are always relayed.
+func (ab *AgoraBot) shouldRelay(h hub.Hub, m *discordgo.Message) bool {
+	isWebhook := m.WebhookID != ""
+	if !isWebhook && !m.Author.Bot {
+		return true
+	}
+
+	if ab.isBridgeBot(m) {
+		return false
+	}
+	if isWebhook && !h.Settings.RelayWebhooks {
+		return false
+	}
+	if !isWebhook && !h.Settings.RelayBots {
+		return false
+	}
+
+	// Content we just relayed coming back from a bot is an echo from another bridge
+	return !ab.loops.isDuplicate(h.ID.Hex(), m.Content)
+}
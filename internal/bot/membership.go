@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// relayPermissions are the permissions the bot needs in a channel to relay the messages of its hub.
+var relayPermissions = []struct {
+	permission int64
+	name       string
+}{
+	{discordgo.PermissionViewChannel, "View Channel"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionManageWebhooks, "Manage Webhooks"},
+}
+
+// canManageChannels reports whether the user who triggered an interaction can manage the channels of the guild.
+func canManageChannels(i *discordgo.InteractionCreate) bool {
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageChannels != 0
+}
+
+// missingRelayPermissions lists the relay permissions the bot lacks in the channel of an interaction.
+func missingRelayPermissions(i *discordgo.InteractionCreate) []string {
+	var missing []string
+	for _, p := range relayPermissions {
+		if i.AppPermissions&p.permission == 0 {
+			missing = append(missing, p.name)
+		}
+	}
+	return missing
+}
+
+func (ab *AgoraBot) joinHub(s *discordgo.Session, i *discordgo.InteractionCreate, value string) {
+	if !canManageChannels(i) {
+		respondError(s, i, "You need the Manage Channels permission to link this channel to a hub.")
+		return
+	}
+
+	channel, errChannel := getChannel(s, i.ChannelID)
+	if errChannel != nil {
+		log.Printf("Error getting channel: %v\n", errChannel)
+		respondError(s, i, "This channel couldn't be loaded, please try again later.")
+		return
+	}
+	if channel.IsThread() {
+		respondError(s, i, "Threads follow their parent channel, link the parent channel instead.")
+		return
+	}
+
+	if missing := missingRelayPermissions(i); len(missing) > 0 {
+		respondError(s, i, fmt.Sprintf("I need the %s permissions in this channel to relay messages.", strings.Join(missing, ", ")))
+		return
+	}
+
+	current, errCurrent := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: i.ChannelID})
+	if errCurrent == nil {
+		respondError(s, i, fmt.Sprintf("This channel is already in the hub **%s**, leave it first with `/hub leave`.", current.Name))
+		return
+	}
+	if !errors.Is(errCurrent, store.ErrNotFound) {
+		respondHubError(s, i, errCurrent)
+		return
+	}
+
+	h, errHub := ab.findHub(value)
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+	if !canJoinHub(h, interactionUser(i).ID) {
+		if canSeeHub(s, h, interactionUser(i).ID, i.GuildID) {
+			respondError(s, i, "This hub is private, only its moderators can link channels to it.")
+		} else {
+			respondHubError(s, i, fmt.Errorf("hub %s %w", value, store.ErrNotFound))
+		}
+		return
+	}
+
+	_, errAdd := queries.AddChannelQuery{}.Do(ab.GetQueryDeps(), store.AddChannelParams{HubID: h.ID, ChannelID: i.ChannelID})
+	if errAdd != nil {
+		log.Printf("Error adding channel to hub: %v\n", errAdd)
+		respondQueryError(s, i, errAdd, "This channel couldn't join the hub, please try again later.")
+		return
+	}
+
+	ab.announceMembership(s, h, h.Channels, i.ChannelID, interactionUser(i).Username, true)
+
+	respondEmbed(s, i, &discordgo.MessageEmbed{
+		Title:       "Hub joined",
+		Description: fmt.Sprintf("This channel is now linked to the hub **%s**.", h.Name),
+		Color:       colorInfo,
+	})
+}
+
+func (ab *AgoraBot) leaveHub(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !canManageChannels(i) {
+		respondError(s, i, "You need the Manage Channels permission to unlink this channel from its hub.")
+		return
+	}
+
+	h, errHub := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: i.ChannelID})
+	if errHub != nil {
+		if errors.Is(errHub, store.ErrNotFound) {
+			respondError(s, i, "This channel isn't in any hub.")
+			return
+		}
+		respondHubError(s, i, errHub)
+		return
+	}
+
+	// Copied before the channel is removed, stores possibly reusing the memory of the channels
+	others := otherChannels(h.Channels, i.ChannelID)
+
+	_, errDelete := queries.DeleteChannelQuery{}.Do(ab.GetQueryDeps(), store.DeleteChannelParams{HubID: h.ID, ChannelID: i.ChannelID})
+	if errDelete != nil {
+		log.Printf("Error removing channel from hub: %v\n", errDelete)
+		respondError(s, i, "This channel couldn't leave the hub, please try again later.")
+		return
+	}
+
+	ab.announceMembership(s, h, others, i.ChannelID, interactionUser(i).Username, false)
+
+	respondEmbed(s, i, &discordgo.MessageEmbed{
+		Title:       "Hub left",
+		Description: fmt.Sprintf("This channel is no longer linked to the hub **%s**.", h.Name),
+		Color:       colorInfo,
+	})
+}
+
+// announceMembership notifies the channels of a hub that a channel joined or left it.
+// Forum channels are skipped, messages only being posted in their posts.
+func (ab *AgoraBot) announceMembership(s *discordgo.Session, h hub.Hub, targets []string, channelID string, author string, joined bool) {
+	vars := formatVars(s, h, author, channelID)
+
+	content := renderFormat(h.Settings.Templates.LeaveFormat(), hub.DefaultLeave, vars)
+	if joined {
+		content = renderFormat(h.Settings.Templates.JoinFormat(), hub.DefaultJoin, vars)
+	}
+
+	for _, targetChannelID := range targets {
+		if isForumChannel(s, targetChannelID) {
+			continue
+		}
+
+		targetChannelID := targetChannelID
+		ab.dispatcher.Enqueue(targetChannelID, func() error {
+			_, err := s.ChannelMessageSendComplex(targetChannelID, &discordgo.MessageSend{
+				Content:         content,
+				AllowedMentions: noMentions(),
+			}, deliveryOptions...)
+			return err
+		}, logFailure("announcing membership change in channel %s", targetChannelID))
+	}
+}
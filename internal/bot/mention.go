@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"regexp"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	userMentionRegex = regexp.MustCompile(`<@!?(\d+)>`)
+	roleMentionRegex = regexp.MustCompile(`<@&(\d+)>`)
+	massMentionRegex = regexp.MustCompile(`@(everyone|here)`)
+)
+
+// noMentions returns allowed mentions that don't let a message ping anyone.
+func noMentions() *discordgo.MessageAllowedMentions {
+	return &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{}}
+}
+
+// rewriteMentions makes the mentions of a relayed message inert in the target guild.
+// @everyone and @here are escaped and role mentions are replaced by the name of the role in the source guild.
+// User mentions are replaced by the name of the user, unless allowPings is set and the user is a member of the target guild,
+// in which case the mention is kept and allowed to ping.
+// The parent of a reply, if any, resolves the mentions of its quote.
+func rewriteMentions(s *discordgo.Session, m *discordgo.Message, parent *discordgo.Message, content string, targetGuildID string, allowPings bool) (string, *discordgo.MessageAllowedMentions) {
+	allowed := noMentions()
+
+	content = massMentionRegex.ReplaceAllString(content, "@\u200b$1")
+
+	content = roleMentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		roleID := roleMentionRegex.FindStringSubmatch(mention)[1]
+		role, errRole := s.State.Role(m.GuildID, roleID)
+		if errRole != nil {
+			return "@unknown-role"
+		}
+		return "@" + role.Name
+	})
+
+	// Replies quote their parent message, whose mentions must be resolved as well
+	users := make(map[string]*discordgo.User)
+	for _, user := range m.Mentions {
+		users[user.ID] = user
+	}
+	if parent != nil {
+		for _, user := range parent.Mentions {
+			users[user.ID] = user
+		}
+	}
+
+	content = userMentionRegex.ReplaceAllStringFunc(content, func(mention string) string {
+		userID := userMentionRegex.FindStringSubmatch(mention)[1]
+
+		if allowPings && isGuildMember(s, targetGuildID, userID) {
+			allowed.Users = append(allowed.Users, userID)
+			return "<@" + userID + ">"
+		}
+
+		user, ok := users[userID]
+		if !ok {
+			return "@unknown-user"
+		}
+		if user.GlobalName != "" {
+			return "@" + user.GlobalName
+		}
+		return "@" + user.Username
+	})
+
+	return content, allowed
+}
+
+// isGuildMember reports whether a user is a member of a guild.
+func isGuildMember(s *discordgo.Session, guildID string, userID string) bool {
+	if _, errState := s.State.Member(guildID, userID); errState == nil {
+		return true
+	}
+
+	_, errMember := s.GuildMember(guildID, userID, deliveryOptions...)
+	return errMember == nil
+}
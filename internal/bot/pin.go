@@ -0,0 +1,167 @@
+package bot
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// pinCache remembers the pinned messages of each channel, so that pin updates can be diffed.
+// Discord only reports that the pins of a channel changed, not which message was pinned or unpinned.
+type pinCache struct {
+	mu   sync.Mutex
+	pins map[string]map[string]struct{}
+}
+
+func newPinCache() *pinCache {
+	return &pinCache{pins: make(map[string]map[string]struct{})}
+}
+
+// update replaces the pins of a channel and returns the messages pinned and unpinned since the last update.
+// The first update of a channel only knows its pins, and returns false.
+func (c *pinCache) update(channelID string, pinned []*discordgo.Message) ([]string, []string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[string]struct{}, len(pinned))
+	for _, m := range pinned {
+		current[m.ID] = struct{}{}
+	}
+
+	previous, known := c.pins[channelID]
+	c.pins[channelID] = current
+	if !known {
+		return nil, nil, false
+	}
+
+	var added, removed []string
+	for id := range current {
+		if _, ok := previous[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed, true
+}
+
+// known reports whether the pins of a channel were recorded since the bot started.
+func (c *pinCache) known(channelID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, known := c.pins[channelID]
+	return known
+}
+
+// set records a pin change made by the bot, so that the resulting update isn't propagated back.
+func (c *pinCache) set(channelID string, messageID string, pinned bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pins, known := c.pins[channelID]
+	if !known {
+		return
+	}
+	if pinned {
+		pins[messageID] = struct{}{}
+	} else {
+		delete(pins, messageID)
+	}
+}
+
+// handleChannelPinsUpdate applies the pins and unpins of a hub channel to the linked copies of the messages
+func (ab *AgoraBot) handleChannelPinsUpdate(s *discordgo.Session, p *discordgo.ChannelPinsUpdate) {
+	h, _, errHub := ab.channelHub(s, p.ChannelID)
+	if errHub != nil {
+		if !errors.Is(errHub, store.ErrNotFound) {
+			log.Printf("Error getting hub of channel: %v\n", errHub)
+		}
+		return
+	}
+
+	pinned, errPinned := s.ChannelMessagesPinned(p.ChannelID)
+	if errPinned != nil {
+		log.Printf("Error getting pinned messages of channel %s: %v\n", p.ChannelID, errPinned)
+		return
+	}
+
+	added, removed, known := ab.pins.update(p.ChannelID, pinned)
+	if !known {
+		// Without previous pins, only a message pinned just now can be identified, pins being listed newest first
+		lastPin, errTime := time.Parse(time.RFC3339, p.LastPinTimestamp)
+		if errTime != nil || time.Since(lastPin) > auditLogWindow || len(pinned) == 0 {
+			return
+		}
+		added = []string{pinned[0].ID}
+	}
+
+	for _, messageID := range added {
+		ab.syncPin(s, h, p.GuildID, p.ChannelID, messageID, true)
+	}
+	for _, messageID := range removed {
+		ab.syncPin(s, h, p.GuildID, p.ChannelID, messageID, false)
+	}
+}
+
+// syncPin pins or unpins the other copies of a linked message, according to the pin policy of the hub.
+func (ab *AgoraBot) syncPin(s *discordgo.Session, h hub.Hub, guildID string, channelID string, messageID string, pinned bool) {
+	if h.Settings.PinsFromModeratorsOnly {
+		action := discordgo.AuditLogActionMessagePin
+		if !pinned {
+			action = discordgo.AuditLogActionMessageUnpin
+		}
+		actorID, found := ab.auditLogActor(s, guildID, channelID, "", messageID, action)
+		if !found || !h.IsModerator(actorID) {
+			return
+		}
+	}
+
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: messageID})
+	if errLink != nil {
+		if !errors.Is(errLink, store.ErrNotFound) {
+			log.Printf("Error getting message link: %v\n", errLink)
+		}
+		return
+	}
+
+	for _, c := range linkedCopies(l) {
+		if c.ChannelID == channelID {
+			continue
+		}
+
+		c := c
+		ab.dispatcher.Enqueue(c.ChannelID, func() error {
+			return ab.setPinned(s, c, pinned)
+		}, logFailure("syncing pin of message %s in channel %s", c.MessageID, c.ChannelID))
+	}
+}
+
+// setPinned pins or unpins a copy of a linked message.
+// The pins of a channel are recorded before the bot first changes them, otherwise the
+// update following its change would look like a pin made by a user and be propagated back.
+func (ab *AgoraBot) setPinned(s *discordgo.Session, c link.Mirror, pinned bool) error {
+	if !ab.pins.known(c.ChannelID) {
+		current, errPinned := s.ChannelMessagesPinned(c.ChannelID, deliveryOptions...)
+		if errPinned != nil {
+			return errPinned
+		}
+		ab.pins.update(c.ChannelID, current)
+	}
+
+	ab.pins.set(c.ChannelID, c.MessageID, pinned)
+	if pinned {
+		return s.ChannelMessagePin(c.ChannelID, c.MessageID, deliveryOptions...)
+	}
+	return s.ChannelMessageUnpin(c.ChannelID, c.MessageID, deliveryOptions...)
+}
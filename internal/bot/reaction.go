@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// mirrorReaction reflects a reaction change on every copy of a linked message.
+// The bot reacts with an emoji on every copy as soon as one user of the hub reacts with it,
+// and removes its reaction once no user of the hub reacts with it anymore.
+func (ab *AgoraBot) mirrorReaction(s *discordgo.Session, r *discordgo.MessageReaction, added bool) {
+	l, count, ok := ab.recordReaction(r, added)
+	if !ok {
+		return
+	}
+
+	// Only the first reaction and the last removal change the reactions of the bot
+	if (added && count != 1) || (!added && count != 0) {
+		return
+	}
+
+	emoji := r.Emoji.APIName()
+	for _, c := range linkedCopies(l) {
+		c := c
+		ab.dispatcher.Enqueue(c.ChannelID, func() error {
+			if added {
+				return s.MessageReactionAdd(c.ChannelID, c.MessageID, emoji, deliveryOptions...)
+			}
+			return s.MessageReactionRemove(c.ChannelID, c.MessageID, emoji, "@me", deliveryOptions...)
+		}, logFailure("mirroring reaction on message %s in channel %s", c.MessageID, c.ChannelID))
+	}
+}
+
+// recordReaction records a reaction change on any copy of a linked message.
+// It returns the link of the message and the number of users of the hub now reacting with the emoji,
+// or false when the message isn't linked or the change couldn't be recorded.
+func (ab *AgoraBot) recordReaction(r *discordgo.MessageReaction, added bool) (link.MessageLink, uint, bool) {
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: r.MessageID})
+	if errLink != nil {
+		if !errors.Is(errLink, store.ErrNotFound) {
+			log.Printf("Error getting message link: %v\n", errLink)
+		}
+		return link.MessageLink{}, 0, false
+	}
+
+	emoji := r.Emoji.APIName()
+
+	var count uint
+	var errCount error
+	if added {
+		count, errCount = queries.AddReactionQuery{}.Do(ab.GetQueryDeps(), store.AddReactionParams{
+			OriginMessageID: l.OriginMessageID,
+			Emoji:           emoji,
+			UserID:          r.UserID,
+		})
+	} else {
+		count, errCount = queries.RemoveReactionQuery{}.Do(ab.GetQueryDeps(), store.RemoveReactionParams{
+			OriginMessageID: l.OriginMessageID,
+			Emoji:           emoji,
+			UserID:          r.UserID,
+		})
+	}
+	if errCount != nil {
+		log.Printf("Error counting reactions: %v\n", errCount)
+		return link.MessageLink{}, 0, false
+	}
+
+	return l, count, true
+}
+
+// linkedCopies returns every copy of a linked message, the original included.
+// Mirrors split into several parts are represented by their first part.
+func linkedCopies(l link.MessageLink) []link.Mirror {
+	copies := []link.Mirror{{ChannelID: l.OriginChannelID, MessageID: l.OriginMessageID}}
+	for _, mirror := range l.Mirrors {
+		if mirror.Part == 0 {
+			copies = append(copies, mirror)
+		}
+	}
+	return copies
+}
+
+// announceReaction announces a reaction change with a message in the given channels of the hub.
+func (ab *AgoraBot) announceReaction(s *discordgo.Session, h hub.Hub, targets []string, r *discordgo.MessageReaction, added bool) {
+	// Get the user who changed the reaction
+	user, err := s.User(r.UserID)
+	if err != nil {
+		log.Printf("Error getting user: %v\n", err)
+		return
+	}
+
+	// Create message about the reaction
+	vars := formatVars(s, h, user.Username, r.ChannelID)
+	vars.Emoji = r.Emoji.MessageFormat()
+	vars.MessageURL = fmt.Sprintf("https://discord.com/channels/%s/%s/%s", r.GuildID, r.ChannelID, r.MessageID)
+
+	fallback := hub.DefaultReactionAdd
+	if !added {
+		fallback = hub.DefaultReactionRemove
+	}
+	content := renderFormat(h.Settings.Templates.ReactionFormat(added), fallback, vars)
+
+	// Echo reaction to other channels in the hub
+	for _, targetChannelID := range targets {
+		targetChannelID := targetChannelID
+		ab.dispatcher.Enqueue(targetChannelID, func() error {
+			_, err := s.ChannelMessageSendComplex(targetChannelID, &discordgo.MessageSend{
+				Content:         content,
+				AllowedMentions: noMentions(),
+			}, deliveryOptions...)
+			return err
+		}, logFailure("announcing reaction in channel %s", targetChannelID))
+	}
+}
@@ -0,0 +1,514 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/deadletter"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// relay bundles an original message with the context needed to render its copies in other channels.
+// The context is gathered by the first delivery using the relay, so that slow requests stay off the event handlers
+// and the relay holds its place in the channel queues from the moment the message is received.
+type relay struct {
+	hub      hub.Hub
+	message  *discordgo.Message
+	download bool
+
+	prepared sync.Once
+	reply    *reply
+	// files are the attachments re-uploaded with the copies, by attachment ID
+	files map[string]attachmentFile
+	// unsupported is set when the message carries content the copies can't render, such as a poll
+	unsupported bool
+}
+
+// newRelay creates the relay of a message.
+// Attachments are only downloaded when download is set, mirrors keeping the files they were sent with when edited.
+func (ab *AgoraBot) newRelay(h hub.Hub, m *discordgo.Message, download bool) *relay {
+	return &relay{
+		hub:      h,
+		message:  m,
+		download: download,
+	}
+}
+
+// relayFingerprint identifies what the copies of a message are made of: its content, attachments and the embeds which are relayed.
+// Link previews Discord generates for links in the content are left out, not being relayed.
+func relayFingerprint(m *discordgo.Message) string {
+	attachments := make([]string, 0, len(m.Attachments))
+	for _, attachment := range m.Attachments {
+		attachments = append(attachments, attachment.ID)
+	}
+
+	state, errState := json.Marshal(struct {
+		Content     string
+		Attachments []string
+		Embeds      []*discordgo.MessageEmbed
+	}{m.Content, attachments, relayEmbeds(m)})
+	if errState != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(state)
+	return hex.EncodeToString(sum[:])
+}
+
+// prepare fetches the message replied to and downloads the attachments of a relay, once for all its deliveries.
+// The message is fetched again for the fields discordgo doesn't decode; attachments are uploaded without
+// their descriptions, and only messages with nothing to render get the unsupported notice, when that fails.
+func (ab *AgoraBot) prepare(s *discordgo.Session, rl *relay) {
+	rl.prepared.Do(func() {
+		rl.reply = ab.getReply(s, rl.message)
+
+		raw, errRaw := fetchRawMessage(s, rl.message)
+		if errRaw != nil {
+			log.Printf("Error getting message %s: %v\n", rl.message.ID, errRaw)
+		}
+		rl.unsupported = raw.Poll != nil || isUnsupported(rl.message)
+		rl.files = ab.attachmentFiles(rl.message, rl.download, raw.descriptions())
+	})
+}
+
+// relayMessage sends the copy of the relayed message into the target channel, starting from the given part.
+// The copy is sent through the channel's webhook to impersonate the original author,
+// falling back to plain bot messages when the bot cannot use webhooks in that channel.
+// It returns the parts which were sent, which are fewer than expected when an error occurs.
+func (ab *AgoraBot) relayMessage(s *discordgo.Session, targetChannelID string, rl *relay, fromPart int) ([]*discordgo.Message, error) {
+	// Threads are relayed into through the webhook of their parent channel
+	parentID, threadID := webhookChannel(s, targetChannelID)
+	wh, errWebhook := ab.getWebhook(s, parentID)
+	if errWebhook != nil {
+		if !isMissingPermissions(errWebhook) {
+			log.Printf("Error getting webhook of channel %s: %v\n", parentID, errWebhook)
+		}
+		return ab.relayMessageAsBot(s, targetChannelID, rl, fromPart)
+	}
+
+	p := ab.buildPayload(s, targetChannelID, rl, false)
+	parts := p.parts()
+
+	var sent []*discordgo.Message
+	for i := fromPart; i < len(parts); i++ {
+		params := &discordgo.WebhookParams{
+			Content:         parts[i],
+			AllowedMentions: p.AllowedMentions,
+			Username:        ab.webhookUsername(s, rl.message),
+			AvatarURL:       authorAvatarURL(rl.message),
+		}
+		if i == 0 {
+			params.Embeds = p.Embeds
+			params.Files = p.Files
+		}
+
+		msg, errExec := webhookExecute(s, wh, threadID, params, p.Attachments)
+		if errExec != nil {
+			if isUnknownWebhook(errExec) {
+				// The webhook was deleted on Discord, a new one will be created for the next message
+				ab.forgetWebhook(parentID)
+				more, errBot := ab.relayMessageAsBot(s, targetChannelID, rl, i)
+				return append(sent, more...), errBot
+			}
+			if isBadRequest(errExec) {
+				// Discord refuses some impersonations, such as reserved names, which the bot can still relay under its own name
+				log.Printf("Error relaying message %s through webhook, sending it as the bot: %v\n", rl.message.ID, errExec)
+				more, errBot := ab.relayMessageAsBot(s, targetChannelID, rl, i)
+				return append(sent, more...), errBot
+			}
+			return sent, errExec
+		}
+		sent = append(sent, msg)
+	}
+
+	return sent, nil
+}
+
+// relayMessageAsBot sends the copy of the relayed message into the target channel as the bot itself, starting from the given part.
+func (ab *AgoraBot) relayMessageAsBot(s *discordgo.Session, targetChannelID string, rl *relay, fromPart int) ([]*discordgo.Message, error) {
+	p := ab.buildPayload(s, targetChannelID, rl, true)
+	parts := p.parts()
+
+	var sent []*discordgo.Message
+	for i := fromPart; i < len(parts); i++ {
+		data := &discordgo.MessageSend{
+			Content:         parts[i],
+			AllowedMentions: p.AllowedMentions,
+		}
+		if i == 0 {
+			data.Embeds = p.Embeds
+			data.Files = p.Files
+			data.Reference = p.Reference
+		}
+
+		msg, errSend := channelMessageSend(s, targetChannelID, data, p.Attachments)
+		if errSend != nil {
+			return sent, errSend
+		}
+		sent = append(sent, msg)
+	}
+
+	return sent, nil
+}
+
+// enqueueRelay queues the relay of a message into the target channel.
+// When linked is set, the parts of the copy are recorded as mirrors of the original message.
+// The relay starts from the given part, and retries resume from the first part which wasn't sent.
+func (ab *AgoraBot) enqueueRelay(s *discordgo.Session, h hub.Hub, targetChannelID string, rl *relay, linked bool, from int) {
+	next := from
+	ab.dispatcher.Enqueue(targetChannelID, func() error {
+		sent, err := ab.relayMessage(s, targetChannelID, rl, next)
+		for _, msg := range sent {
+			ab.loops.remember(rl.hub.ID.Hex(), msg.Content)
+			if linked {
+				ab.addMirror(s, rl, msg, next)
+			}
+			next++
+		}
+		return err
+	}, func(err error, attempts int) {
+		ab.deadLetter(deadletter.KindMessage, h.ID, targetChannelID, rl.message, next)(err, attempts)
+	})
+}
+
+// enqueueEdit queues the edit of the mirrors of a message in the target channel.
+func (ab *AgoraBot) enqueueEdit(s *discordgo.Session, h hub.Hub, targetChannelID string, rl *relay) {
+	ab.dispatcher.Enqueue(targetChannelID, func() error {
+		return ab.editMirrorsIn(s, targetChannelID, rl)
+	}, ab.deadLetter(deadletter.KindEdit, h.ID, targetChannelID, rl.message, 0))
+}
+
+// editMirrorsIn applies the current state of the relayed message to its mirrors in the target channel.
+// The link is looked up when the edit is delivered, so that mirrors relayed in the meantime are edited too.
+// When the edited copy needs fewer parts than before, the extra parts are deleted, and when it needs more, they are sent.
+func (ab *AgoraBot) editMirrorsIn(s *discordgo.Session, targetChannelID string, rl *relay) error {
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: rl.message.ID})
+	if errors.Is(errLink, store.ErrNotFound) {
+		return nil
+	}
+	if errLink != nil {
+		return errLink
+	}
+
+	mirrors := l.MirrorsIn(targetChannelID)
+	if len(mirrors) == 0 {
+		return nil
+	}
+
+	asBot := mirrors[0].WebhookID == ""
+	p := ab.buildPayload(s, targetChannelID, rl, asBot)
+	parts := p.parts()
+
+	var errs []error
+	for i, mirror := range mirrors {
+		if i >= len(parts) {
+			if errDelete := ab.deleteRelayedMessage(s, mirror); errDelete != nil {
+				errs = append(errs, fmt.Errorf("error deleting message %s: %w", mirror.MessageID, errDelete))
+				continue
+			}
+			_, errMirror := queries.DeleteMirrorQuery{}.Do(ab.GetQueryDeps(), store.DeleteMirrorParams{MessageID: mirror.MessageID})
+			if errMirror != nil {
+				errs = append(errs, errMirror)
+			}
+			continue
+		}
+
+		err := ab.editRelayedMessage(s, mirror, rl, p, parts[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error editing message %s: %w", mirror.MessageID, err))
+		}
+	}
+
+	// Edits replace the embeds of the first part, the reaction summary included
+	if rl.hub.Settings.Reactions() == hub.ReactionModeDigest {
+		ab.scheduleDigest(s, l.OriginMessageID)
+	}
+
+	if len(parts) > len(mirrors) {
+		relayParts := ab.relayMessage
+		if asBot {
+			relayParts = ab.relayMessageAsBot
+		}
+
+		sent, errSend := relayParts(s, targetChannelID, rl, len(mirrors))
+		for i, msg := range sent {
+			ab.addMirror(s, rl, msg, len(mirrors)+i)
+		}
+		if errSend != nil {
+			errs = append(errs, errSend)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// editRelayedMessage applies the given content to a part of a mirror.
+// Embeds and attachments belong to the first part, the other parts only holding content.
+func (ab *AgoraBot) editRelayedMessage(s *discordgo.Session, mirror link.Mirror, rl *relay, p payload, content string) error {
+	embeds := []*discordgo.MessageEmbed{}
+	var attachments *[]*discordgo.MessageAttachment
+
+	if mirror.Part == 0 {
+		embeds = p.Embeds
+
+		// Attachments can only be removed from a message, drop the files of the mirror removed from the original
+		var errAttachments error
+		attachments, errAttachments = ab.keptAttachments(s, mirror, rl)
+		if errAttachments != nil {
+			return errAttachments
+		}
+	}
+
+	if mirror.WebhookID == "" {
+		_, errEdit := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:              mirror.MessageID,
+			Channel:         mirror.ChannelID,
+			Content:         &content,
+			Embeds:          &embeds,
+			Attachments:     attachments,
+			AllowedMentions: p.AllowedMentions,
+		}, deliveryOptions...)
+		return errEdit
+	}
+
+	parentID, threadID := webhookChannel(s, mirror.ChannelID)
+	wh, errWebhook := queries.GetWebhookQuery{}.Do(ab.GetQueryDeps(), store.GetWebhookParams{ChannelID: parentID})
+	if errWebhook != nil {
+		return errWebhook
+	}
+	if wh.ID != mirror.WebhookID {
+		return fmt.Errorf("webhook %s of message %s no longer exists", mirror.WebhookID, mirror.MessageID)
+	}
+
+	return webhookMessageEdit(s, wh, threadID, mirror.MessageID, &discordgo.WebhookEdit{
+		Content:         &content,
+		Embeds:          &embeds,
+		Attachments:     attachments,
+		AllowedMentions: p.AllowedMentions,
+	})
+}
+
+// payload is the rendered form of a relayed copy of a message in a target channel.
+type payload struct {
+	Content         string
+	Embeds          []*discordgo.MessageEmbed
+	Files           []*discordgo.File
+	Attachments     []uploadAttachment
+	Reference       *discordgo.MessageReference
+	AllowedMentions *discordgo.MessageAllowedMentions
+}
+
+// parts returns the content of the payload split into messages Discord accepts.
+func (p payload) parts() []string {
+	return splitContent(p.Content, maxContentLength)
+}
+
+// buildPayload renders the copy of the relayed message in the target channel.
+// Copies sent as the bot itself are prefixed by a header naming the original author.
+// References to channels and emojis are translated for the target guild,
+// and mentions are rewritten so that the copy never pings more than the hub allows.
+func (ab *AgoraBot) buildPayload(s *discordgo.Session, targetChannelID string, rl *relay, asBot bool) payload {
+	ab.prepare(s, rl)
+
+	m := rl.message
+	p := payload{
+		Content: rl.content(),
+		Embeds:  append(relayEmbeds(m), stickerEmbeds(m)...),
+	}
+	p.Files, p.Attachments = rl.uploads()
+	if len(p.Embeds) > maxEmbeds {
+		p.Embeds = p.Embeds[:maxEmbeds]
+	}
+
+	if rl.reply != nil {
+		var quote string
+		p.Reference, quote = rl.reply.render(s, targetChannelID, asBot)
+		p.Content = quote + p.Content
+	}
+
+	targetGuildID := ""
+	if channel, errChannel := s.State.Channel(targetChannelID); errChannel == nil {
+		targetGuildID = channel.GuildID
+	}
+	p.Content = translateReferences(s, rl, p.Content, targetChannelID, targetGuildID)
+
+	if asBot {
+		header := renderFormat(rl.hub.Settings.Templates.HeaderFormat(), hub.DefaultHeader,
+			formatVars(s, rl.hub, m.Author.Username, m.ChannelID))
+		p.Content = header + "\n" + p.Content
+	}
+
+	// The parent of the reply is fetched when the gateway didn't include it
+	var parent *discordgo.Message
+	if rl.reply != nil {
+		parent = rl.reply.parent
+	}
+	p.Content, p.AllowedMentions = rewriteMentions(s, m, parent, p.Content, targetGuildID, rl.hub.Settings.AllowMemberPings)
+
+	return p
+}
+
+// content returns the content of a relayed copy of the message.
+// Attachments which are not re-uploaded are linked, with a notice.
+func (rl *relay) content() string {
+	content := rl.message.Content
+
+	for _, attachment := range rl.message.Attachments {
+		if _, ok := rl.files[attachment.ID]; !ok {
+			content += fmt.Sprintf("\n📎 [%s](%s) *(too large to be re-uploaded)*", attachment.Filename, attachment.URL)
+		}
+	}
+
+	content += stickerNames(rl.message)
+
+	if rl.unsupported {
+		if content != "" {
+			content += "\n"
+		}
+		content += unsupportedPlaceholder
+	}
+
+	return content
+}
+
+// deleteLinkedMessages propagates the deletion of a message to its linked copies.
+// Deleting an original message removes all of its mirrors. Deleting a mirror only hides it in its own channel,
+// unless deleter reports a hub moderator, in which case the original and every other mirror are removed too.
+func (ab *AgoraBot) deleteLinkedMessages(s *discordgo.Session, messageID string, deleter func(authorID string) string) {
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: messageID})
+	if errLink != nil {
+		if !errors.Is(errLink, store.ErrNotFound) {
+			log.Printf("Error getting message link: %v\n", errLink)
+		}
+		return
+	}
+
+	if l.OriginMessageID != messageID {
+		h, errHub := queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: l.HubID})
+		if errHub != nil || !h.IsModerator(deleter(mirrorAuthor(s, l, messageID))) {
+			_, errMirror := queries.DeleteMirrorQuery{}.Do(ab.GetQueryDeps(), store.DeleteMirrorParams{MessageID: messageID})
+			if errMirror != nil {
+				log.Printf("Error deleting mirror %s: %v\n", messageID, errMirror)
+			}
+			return
+		}
+	}
+
+	// Forget the link first so that the deletions made by the bot are not processed again
+	_, errDelete := queries.DeleteMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.DeleteMessageLinkParams{OriginMessageID: l.OriginMessageID})
+	if errDelete != nil {
+		log.Printf("Error deleting message link %s: %v\n", l.OriginMessageID, errDelete)
+		return
+	}
+
+	if l.OriginMessageID != messageID {
+		ab.dispatcher.Enqueue(l.OriginChannelID, func() error {
+			return s.ChannelMessageDelete(l.OriginChannelID, l.OriginMessageID, deliveryOptions...)
+		}, logFailure("deleting message %s in channel %s", l.OriginMessageID, l.OriginChannelID))
+	}
+
+	for _, mirror := range l.Mirrors {
+		if mirror.MessageID == messageID {
+			continue
+		}
+
+		mirror := mirror
+		ab.dispatcher.Enqueue(mirror.ChannelID, func() error {
+			return ab.deleteRelayedMessage(s, mirror)
+		}, logFailure("deleting message %s in channel %s", mirror.MessageID, mirror.ChannelID))
+	}
+}
+
+// mirrorAuthor returns the ID of the author of a mirror, the webhook which sent it or the bot.
+func mirrorAuthor(s *discordgo.Session, l link.MessageLink, messageID string) string {
+	for _, mirror := range l.Mirrors {
+		if mirror.MessageID == messageID && mirror.WebhookID != "" {
+			return mirror.WebhookID
+		}
+	}
+	return s.State.User.ID
+}
+
+// deleteRelayedMessage deletes a mirrored copy of a message.
+func (ab *AgoraBot) deleteRelayedMessage(s *discordgo.Session, mirror link.Mirror) error {
+	if mirror.WebhookID != "" {
+		parentID, threadID := webhookChannel(s, mirror.ChannelID)
+		wh, errWebhook := queries.GetWebhookQuery{}.Do(ab.GetQueryDeps(), store.GetWebhookParams{ChannelID: parentID})
+		if errWebhook == nil && wh.ID == mirror.WebhookID {
+			return webhookMessageDelete(s, wh, threadID, mirror.MessageID)
+		}
+	}
+
+	return s.ChannelMessageDelete(mirror.ChannelID, mirror.MessageID, deliveryOptions...)
+}
+
+// addMirror records a part of a relayed copy of an original message in the message link store.
+// When the link of the original is missing, it is recorded again or the copy is deleted, see relinkMirror.
+func (ab *AgoraBot) addMirror(s *discordgo.Session, rl *relay, sent *discordgo.Message, part int) {
+	mirror := link.Mirror{
+		ChannelID: sent.ChannelID,
+		MessageID: sent.ID,
+		WebhookID: sent.WebhookID,
+		Part:      part,
+	}
+
+	_, errMirror := queries.AddMirrorQuery{}.Do(ab.GetQueryDeps(), store.AddMirrorParams{
+		OriginMessageID: rl.message.ID,
+		Mirror:          mirror,
+	})
+	if errors.Is(errMirror, store.ErrNotFound) {
+		errMirror = ab.relinkMirror(s, rl, mirror)
+	}
+	if errMirror != nil {
+		log.Printf("Error recording mirror of message %s: %v\n", rl.message.ID, errMirror)
+	}
+}
+
+// relinkMirror handles a copy whose original message has no link.
+// When the original was deleted while the copy was queued, the copy is deleted as well.
+// Otherwise the link expired, as with dead letters replayed late, and is recorded again along with the copy.
+func (ab *AgoraBot) relinkMirror(s *discordgo.Session, rl *relay, mirror link.Mirror) error {
+	_, errOriginal := s.ChannelMessage(rl.message.ChannelID, rl.message.ID, deliveryOptions...)
+	if isRESTError(errOriginal, http.StatusNotFound, discordgo.ErrCodeUnknownMessage) {
+		if errDelete := ab.deleteRelayedMessage(s, mirror); errDelete != nil {
+			return fmt.Errorf("error deleting message %s in channel %s: %w", mirror.MessageID, mirror.ChannelID, errDelete)
+		}
+		return nil
+	}
+	if errOriginal != nil {
+		return fmt.Errorf("error getting message %s: %w", rl.message.ID, errOriginal)
+	}
+
+	_, errLink := queries.AddMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.AddMessageLinkParams{
+		Link: link.MessageLink{
+			OriginMessageID: rl.message.ID,
+			OriginChannelID: rl.message.ChannelID,
+			OriginGuildID:   rl.message.GuildID,
+			HubID:           rl.hub.ID,
+			Mirrors:         []link.Mirror{mirror},
+			Fingerprint:     relayFingerprint(rl.message),
+			CreatedAt:       time.Now(),
+		},
+	})
+	if errLink == nil {
+		return nil
+	}
+
+	// Another part of the copy may have recorded the link again in the meantime
+	_, errMirror := queries.AddMirrorQuery{}.Do(ab.GetQueryDeps(), store.AddMirrorParams{
+		OriginMessageID: rl.message.ID,
+		Mirror:          mirror,
+	})
+	return errMirror
+}
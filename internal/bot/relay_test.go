@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRelayFingerprint(t *testing.T) {
+	original := &discordgo.Message{
+		Content:     "see https://example.com",
+		Attachments: []*discordgo.MessageAttachment{{ID: "1", Filename: "a.png"}},
+	}
+	fingerprint := relayFingerprint(original)
+
+	tests := []struct {
+		name    string
+		message *discordgo.Message
+		changed bool
+	}{
+		{
+			name: "link preview added",
+			message: &discordgo.Message{
+				Content:     original.Content,
+				Attachments: original.Attachments,
+				Embeds:      []*discordgo.MessageEmbed{{Type: discordgo.EmbedTypeLink, URL: "https://example.com", Title: "Example"}},
+			},
+		},
+		{
+			name: "flags changed",
+			message: &discordgo.Message{
+				Content:     original.Content,
+				Attachments: original.Attachments,
+				Flags:       discordgo.MessageFlagsSuppressEmbeds,
+			},
+		},
+		{
+			name:    "content edited",
+			message: &discordgo.Message{Content: "see https://example.org", Attachments: original.Attachments},
+			changed: true,
+		},
+		{
+			name:    "attachment removed",
+			message: &discordgo.Message{Content: original.Content},
+			changed: true,
+		},
+		{
+			name: "rich embed added",
+			message: &discordgo.Message{
+				Content:     original.Content,
+				Attachments: original.Attachments,
+				Embeds:      []*discordgo.MessageEmbed{{Type: discordgo.EmbedTypeRich, Title: "Status"}},
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if changed := relayFingerprint(tt.message) != fingerprint; changed != tt.changed {
+				t.Errorf("fingerprint changed: %t, want %t", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// maxQuoteLength is the maximum number of characters of a parent message quoted in a relayed reply.
+const maxQuoteLength = 100
+
+// reply describes the message a relayed message replies to.
+type reply struct {
+	parent *discordgo.Message
+	link   *link.MessageLink
+}
+
+// getReply returns the message the given message replies to, or nil if it is not a reply.
+func (ab *AgoraBot) getReply(s *discordgo.Session, m *discordgo.Message) *reply {
+	if m.Type != discordgo.MessageTypeReply || m.MessageReference == nil {
+		return nil
+	}
+
+	rp := &reply{parent: m.ReferencedMessage}
+	if rp.parent == nil {
+		parent, errParent := s.ChannelMessage(m.MessageReference.ChannelID, m.MessageReference.MessageID)
+		if errParent != nil {
+			// The parent message was deleted
+			return nil
+		}
+		rp.parent = parent
+	}
+
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: rp.parent.ID})
+	if errLink == nil {
+		rp.link = &l
+	} else if !errors.Is(errLink, store.ErrNotFound) {
+		log.Printf("Error getting message link: %v\n", errLink)
+	}
+
+	return rp
+}
+
+// render returns how the reply is relayed into the target channel.
+// When the copy of the parent message in that channel is known, messages sent as the bot reference it directly
+// while webhook messages, which cannot reply, quote it with a link to it.
+// Otherwise, a quoted snippet of the parent message is returned.
+func (rp *reply) render(s *discordgo.Session, targetChannelID string, asBot bool) (*discordgo.MessageReference, string) {
+	parentID, found := "", false
+	if rp.link != nil {
+		parentID, found = rp.link.MessageIn(targetChannelID)
+	}
+
+	if found && asBot {
+		failIfNotExists := false
+		return &discordgo.MessageReference{
+			MessageID:       parentID,
+			ChannelID:       targetChannelID,
+			FailIfNotExists: &failIfNotExists,
+		}, ""
+	}
+
+	author := "Unknown"
+	if rp.parent.Author != nil {
+		author = rp.parent.Author.Username
+		if rp.parent.Author.GlobalName != "" {
+			author = rp.parent.Author.GlobalName
+		}
+	}
+
+	if found {
+		if channel, errChannel := s.State.Channel(targetChannelID); errChannel == nil {
+			author = fmt.Sprintf("[%s](https://discord.com/channels/%s/%s/%s)", author, channel.GuildID, targetChannelID, parentID)
+		}
+	}
+
+	return nil, fmt.Sprintf("> ↪ **%s**: %s\n", author, quoteSnippet(rp.parent))
+}
+
+// quoteSnippet returns a short single-line excerpt of a message.
+func quoteSnippet(m *discordgo.Message) string {
+	snippet := strings.Join(strings.Fields(m.Content), " ")
+	if snippet == "" {
+		if len(m.Attachments) > 0 || len(m.Embeds) > 0 {
+			return "*attachment*"
+		}
+		return "*empty message*"
+	}
+
+	runes := []rune(snippet)
+	if len(runes) > maxQuoteLength {
+		snippet = string(runes[:maxQuoteLength]) + "…"
+	}
+
+	return snippet
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxEmbeds is the maximum number of embeds Discord accepts on a message.
+const maxEmbeds = 10
+
+// unsupportedPlaceholder is added to the content of messages carrying content which cannot be relayed, such as polls.
+const unsupportedPlaceholder = "*[This message contains content that cannot be relayed]*"
+
+// rawMessage holds the fields of a message which discordgo doesn't decode.
+type rawMessage struct {
+	Attachments []struct {
+		ID          string `json:"id"`
+		Description string `json:"description"`
+	} `json:"attachments"`
+	Poll *struct{} `json:"poll"`
+}
+
+// fetchRawMessage fetches a message again to read the fields discordgo doesn't decode.
+func fetchRawMessage(s *discordgo.Session, m *discordgo.Message) (rawMessage, error) {
+	var raw rawMessage
+
+	endpoint := discordgo.EndpointChannelMessage(m.ChannelID, m.ID)
+	response, errGet := s.RequestWithBucketID(http.MethodGet, endpoint, nil, discordgo.EndpointChannelMessage(m.ChannelID, ""), deliveryOptions...)
+	if errGet != nil {
+		return raw, errGet
+	}
+
+	errDecode := json.Unmarshal(response, &raw)
+	return raw, errDecode
+}
+
+// descriptions returns the descriptions of the attachments of the message, by attachment ID.
+func (raw rawMessage) descriptions() map[string]string {
+	descriptions := make(map[string]string, len(raw.Attachments))
+	for _, attachment := range raw.Attachments {
+		descriptions[attachment.ID] = attachment.Description
+	}
+	return descriptions
+}
+
+// relayEmbeds returns the embeds of a relayed copy of the given message.
+// Rich embeds are copied as is. Link previews are converted to rich embeds,
+// unless their link is part of the content, in which case Discord generates them again.
+func relayEmbeds(m *discordgo.Message) []*discordgo.MessageEmbed {
+	embeds := []*discordgo.MessageEmbed{}
+
+	for _, embed := range m.Embeds {
+		if len(embeds) == maxEmbeds {
+			break
+		}
+
+		if embed.Type == discordgo.EmbedTypeRich || embed.Type == "" {
+			embeds = append(embeds, embed)
+			continue
+		}
+
+		if embed.URL != "" && strings.Contains(m.Content, embed.URL) {
+			continue
+		}
+
+		embeds = append(embeds, previewEmbed(embed))
+	}
+
+	return embeds
+}
+
+// previewEmbed converts a link preview embed generated by Discord into a rich embed.
+func previewEmbed(embed *discordgo.MessageEmbed) *discordgo.MessageEmbed {
+	preview := &discordgo.MessageEmbed{
+		Type:        discordgo.EmbedTypeRich,
+		URL:         embed.URL,
+		Title:       embed.Title,
+		Description: embed.Description,
+		Color:       embed.Color,
+		Author:      embed.Author,
+	}
+
+	if preview.Author == nil && embed.Provider != nil && embed.Provider.Name != "" {
+		preview.Author = &discordgo.MessageEmbedAuthor{
+			Name: embed.Provider.Name,
+			URL:  embed.Provider.URL,
+		}
+	}
+
+	if embed.Image != nil {
+		preview.Image = &discordgo.MessageEmbedImage{URL: embed.Image.URL}
+	}
+	if embed.Thumbnail != nil {
+		if embed.Type == discordgo.EmbedTypeImage || embed.Type == discordgo.EmbedTypeGifv {
+			preview.Image = &discordgo.MessageEmbedImage{URL: embed.Thumbnail.URL}
+		} else {
+			preview.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: embed.Thumbnail.URL}
+		}
+	}
+
+	if preview.Title == "" && preview.Description == "" && preview.Image == nil {
+		preview.Description = embed.URL
+	}
+
+	return preview
+}
+
+// stickerURL returns the URL of the image of a sticker, or false for stickers which are not images.
+func stickerURL(sticker *discordgo.StickerItem) (string, bool) {
+	switch sticker.FormatType {
+	case discordgo.StickerFormatTypePNG, discordgo.StickerFormatTypeAPNG:
+		return fmt.Sprintf("https://media.discordapp.net/stickers/%s.png", sticker.ID), true
+	case discordgo.StickerFormatTypeGIF:
+		return fmt.Sprintf("https://media.discordapp.net/stickers/%s.gif", sticker.ID), true
+	default:
+		return "", false
+	}
+}
+
+// stickerEmbeds renders the image stickers of a message as embeds.
+// Stickers can't be sent as such since they may belong to a guild the target channel is not part of.
+func stickerEmbeds(m *discordgo.Message) []*discordgo.MessageEmbed {
+	var embeds []*discordgo.MessageEmbed
+
+	for _, sticker := range m.StickerItems {
+		url, ok := stickerURL(sticker)
+		if !ok {
+			continue
+		}
+
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Type:   discordgo.EmbedTypeRich,
+			Footer: &discordgo.MessageEmbedFooter{Text: sticker.Name},
+			Image:  &discordgo.MessageEmbedImage{URL: url},
+		})
+	}
+
+	return embeds
+}
+
+// stickerNames renders the stickers of a message which are not images by their name.
+func stickerNames(m *discordgo.Message) string {
+	var names string
+
+	for _, sticker := range m.StickerItems {
+		if _, ok := stickerURL(sticker); !ok {
+			names += fmt.Sprintf("\n*[Sticker: %s]*", sticker.Name)
+		}
+	}
+
+	return names
+}
+
+// isUnsupported reports whether a message carries nothing the relay can render,
+// which is the case of content types unknown to discordgo.
+func isUnsupported(m *discordgo.Message) bool {
+	return m.Content == "" &&
+		len(m.Attachments) == 0 &&
+		len(m.Embeds) == 0 &&
+		len(m.StickerItems) == 0
+}
+
+// isRelayable reports whether a message is sent by a user, as opposed to system messages such as join notices.
+func isRelayable(m *discordgo.Message) bool {
+	switch m.Type {
+	case discordgo.MessageTypeDefault,
+		discordgo.MessageTypeReply,
+		discordgo.MessageTypeChatInputCommand,
+		discordgo.MessageTypeContextMenuCommand:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,429 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/format"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Handler names of the components and modals of the settings panel, their custom IDs ending with the ID of the hub.
+const (
+	settingsReactionsID      = "settings-reactions"
+	settingsOptionsID        = "settings-options"
+	settingsChannelsID       = "settings-channels"
+	settingsModeratorsID     = "settings-moderators"
+	settingsDetailsID        = "settings-details"
+	settingsDetailsModalID   = "settings-details-modal"
+	settingsTemplatesID      = "settings-templates"
+	settingsTemplatesModalID = "settings-templates-modal"
+)
+
+// maxSelectOptions is the number of options Discord accepts in a select menu.
+const maxSelectOptions = 25
+
+// reactionModes are the choices of the reaction mode menu.
+var reactionModes = []struct {
+	mode        hub.ReactionMode
+	label       string
+	description string
+}{
+	{hub.ReactionModeMirror, "Mirror", "React with the same emojis on every copy of a message"},
+	{hub.ReactionModeAnnounce, "Announce", "Post a notice in the other channels for each reaction"},
+	{hub.ReactionModeDigest, "Digest", "Summarize the reactions of every server under each copy"},
+}
+
+// relayOptions are the choices of the relay options menu, each one toggling a setting of the hub.
+var relayOptions = []struct {
+	value       string
+	label       string
+	description string
+	setting     func(settings *hub.Settings) *bool
+}{
+	{"public", "Public", "Anyone can find the hub and join it",
+		func(settings *hub.Settings) *bool { return &settings.Public }},
+	{"allow_member_pings", "Member pings", "Relayed mentions ping the members of the target server",
+		func(settings *hub.Settings) *bool { return &settings.AllowMemberPings }},
+	{"emoji_images", "Emoji images", "Replace unavailable custom emojis by a link to their image",
+		func(settings *hub.Settings) *bool { return &settings.EmojiImages }},
+	{"relay_bots", "Relay bots", "Relay the messages of other bots",
+		func(settings *hub.Settings) *bool { return &settings.RelayBots }},
+	{"relay_webhooks", "Relay webhooks", "Relay the messages of webhooks other than the bot's own",
+		func(settings *hub.Settings) *bool { return &settings.RelayWebhooks }},
+	{"pins_from_moderators_only", "Moderator pins only", "Only sync the pins and unpins made by moderators",
+		func(settings *hub.Settings) *bool { return &settings.PinsFromModeratorsOnly }},
+}
+
+// templateInputs are the text inputs of the message formats modal.
+var templateInputs = []struct {
+	id       string
+	label    string
+	template func(templates *hub.Templates) *string
+}{
+	{"header", "Relayed message header",
+		func(templates *hub.Templates) *string { return &templates.Header }},
+	{"reaction_add", "Reaction added notice",
+		func(templates *hub.Templates) *string { return &templates.ReactionAdd }},
+	{"reaction_remove", "Reaction removed notice",
+		func(templates *hub.Templates) *string { return &templates.ReactionRemove }},
+	{"join", "Channel joined notice",
+		func(templates *hub.Templates) *string { return &templates.Join }},
+	{"leave", "Channel left notice",
+		func(templates *hub.Templates) *string { return &templates.Leave }},
+}
+
+func (ab *AgoraBot) openSettings(s *discordgo.Session, i *discordgo.InteractionCreate, value string) {
+	h, errHub := ab.findHub(value)
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+	if !h.IsModerator(interactionUser(i).ID) {
+		respondError(s, i, "Only the moderators of a hub can change its settings.")
+		return
+	}
+
+	errRespond := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: settingsPanel(s, h, interactionUser(i).ID),
+	})
+	if errRespond != nil {
+		log.Printf("Error responding to interaction: %v\n", errRespond)
+	}
+}
+
+// settingsPanel shows the settings of a hub with the components editing them, as seen by the given user.
+// Only the owner can change the moderators.
+func settingsPanel(s *discordgo.Session, h hub.Hub, userID string) *discordgo.InteractionResponseData {
+	id := h.ID.Hex()
+	none := 0
+
+	modes := make([]discordgo.SelectMenuOption, len(reactionModes))
+	for n, choice := range reactionModes {
+		modes[n] = discordgo.SelectMenuOption{
+			Label:       choice.label,
+			Value:       string(choice.mode),
+			Description: choice.description,
+			Default:     h.Settings.Reactions() == choice.mode,
+		}
+	}
+
+	options := make([]discordgo.SelectMenuOption, len(relayOptions))
+	for n, choice := range relayOptions {
+		options[n] = discordgo.SelectMenuOption{
+			Label:       choice.label,
+			Value:       choice.value,
+			Description: choice.description,
+			Default:     *choice.setting(&h.Settings),
+		}
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				CustomID:    customID(settingsReactionsID, id),
+				Placeholder: "Reaction mode",
+				Options:     modes,
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				CustomID:    customID(settingsOptionsID, id),
+				Placeholder: "No relay option enabled",
+				MinValues:   &none,
+				MaxValues:   len(options),
+				Options:     options,
+			},
+		}},
+	}
+
+	if channels := channelOptions(s, h); len(channels) > 0 {
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				CustomID:    customID(settingsChannelsID, id),
+				Placeholder: "Unlink channels from the hub",
+				MaxValues:   len(channels),
+				Options:     channels,
+			},
+		}})
+	}
+
+	moderators := make([]discordgo.SelectMenuDefaultValue, 0, len(h.Moderators))
+	for _, moderatorID := range h.Moderators {
+		if len(moderators) == maxSelectOptions {
+			break
+		}
+		moderators = append(moderators, discordgo.SelectMenuDefaultValue{
+			ID:   moderatorID,
+			Type: discordgo.SelectMenuDefaultValueUser,
+		})
+	}
+	components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.SelectMenu{
+			MenuType:      discordgo.UserSelectMenu,
+			CustomID:      customID(settingsModeratorsID, id),
+			Placeholder:   "No moderator besides the owner",
+			MinValues:     &none,
+			MaxValues:     maxSelectOptions,
+			DefaultValues: moderators,
+			Disabled:      h.OwnerID != userID,
+		},
+	}})
+
+	components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "Edit name and description",
+			Style:    discordgo.SecondaryButton,
+			CustomID: customID(settingsDetailsID, id),
+		},
+		discordgo.Button{
+			Label:    "Edit message formats",
+			Style:    discordgo.SecondaryButton,
+			CustomID: customID(settingsTemplatesID, id),
+		},
+	}})
+
+	return &discordgo.InteractionResponseData{
+		Embeds:     []*discordgo.MessageEmbed{hubEmbed(h)},
+		Components: components,
+		Flags:      discordgo.MessageFlagsEphemeral,
+	}
+}
+
+// channelOptions lists the channels of a hub as options of a select menu, named after their guild when it is cached.
+func channelOptions(s *discordgo.Session, h hub.Hub) []discordgo.SelectMenuOption {
+	var options []discordgo.SelectMenuOption
+	for _, channelID := range h.Channels {
+		if len(options) == maxSelectOptions {
+			break
+		}
+
+		option := discordgo.SelectMenuOption{Label: channelID, Value: channelID}
+		if channel, errChannel := s.State.Channel(channelID); errChannel == nil {
+			option.Label = "#" + channel.Name
+			if guild, errGuild := s.State.Guild(channel.GuildID); errGuild == nil {
+				option.Description = guild.Name
+			}
+		}
+		options = append(options, option)
+	}
+	return options
+}
+
+// settingsHub returns the hub whose settings a panel interaction changes, replying with an error when the hub
+// no longer exists or the user doesn't moderate it.
+func (ab *AgoraBot) settingsHub(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) (hub.Hub, bool) {
+	if len(args) == 0 {
+		return hub.Hub{}, false
+	}
+	id, errID := primitive.ObjectIDFromHex(args[0])
+	if errID != nil {
+		log.Printf("Error parsing hub ID of interaction: %v\n", errID)
+		return hub.Hub{}, false
+	}
+
+	h, errHub := queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: id})
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return hub.Hub{}, false
+	}
+	if !h.IsModerator(interactionUser(i).ID) {
+		respondError(s, i, "Only the moderators of a hub can change its settings.")
+		return hub.Hub{}, false
+	}
+	return h, true
+}
+
+// refreshSettings shows the current settings of a hub in the panel of an interaction.
+func (ab *AgoraBot) refreshSettings(s *discordgo.Session, i *discordgo.InteractionCreate, id primitive.ObjectID) {
+	h, errHub := queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: id})
+	if errHub != nil {
+		respondHubError(s, i, errHub)
+		return
+	}
+	respondUpdate(s, i, settingsPanel(s, h, interactionUser(i).ID))
+}
+
+// saveSettings saves the settings of a hub and refreshes its panel.
+func (ab *AgoraBot) saveSettings(s *discordgo.Session, i *discordgo.InteractionCreate, h hub.Hub) {
+	_, errUpdate := queries.UpdateHubSettingsQuery{}.Do(ab.GetQueryDeps(), store.UpdateHubSettingsParams{HubID: h.ID, Settings: h.Settings})
+	if errUpdate != nil {
+		log.Printf("Error updating hub settings: %v\n", errUpdate)
+		respondError(s, i, "The settings couldn't be saved, please try again later.")
+		return
+	}
+	ab.refreshSettings(s, i, h.ID)
+}
+
+func (ab *AgoraBot) setReactionMode(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return
+	}
+	h.Settings.ReactionMode = hub.ReactionMode(values[0])
+	ab.saveSettings(s, i, h)
+}
+
+func (ab *AgoraBot) setRelayOptions(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	selected := make(map[string]bool)
+	for _, value := range i.MessageComponentData().Values {
+		selected[value] = true
+	}
+	for _, option := range relayOptions {
+		*option.setting(&h.Settings) = selected[option.value]
+	}
+	ab.saveSettings(s, i, h)
+}
+
+func (ab *AgoraBot) unlinkChannels(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	// Cloned as stores may reuse the memory of the channels when removing one
+	remaining := slices.Clone(h.Channels)
+	for _, channelID := range i.MessageComponentData().Values {
+		_, errDelete := queries.DeleteChannelQuery{}.Do(ab.GetQueryDeps(), store.DeleteChannelParams{HubID: h.ID, ChannelID: channelID})
+		if errDelete != nil {
+			log.Printf("Error removing channel from hub: %v\n", errDelete)
+			continue
+		}
+
+		remaining = otherChannels(remaining, channelID)
+		ab.announceMembership(s, h, remaining, channelID, interactionUser(i).Username, false)
+	}
+	ab.refreshSettings(s, i, h.ID)
+}
+
+func (ab *AgoraBot) setModerators(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+	if h.OwnerID != interactionUser(i).ID {
+		respondError(s, i, "Only the owner of a hub can change its moderators.")
+		return
+	}
+
+	// The owner moderates their hub without being listed
+	selected := i.MessageComponentData().Values
+	for _, userID := range selected {
+		if userID == h.OwnerID || slices.Contains(h.Moderators, userID) {
+			continue
+		}
+		_, errAdd := queries.AddModeratorQuery{}.Do(ab.GetQueryDeps(), store.AddModeratorParams{HubID: h.ID, UserID: userID})
+		if errAdd != nil {
+			log.Printf("Error adding moderator: %v\n", errAdd)
+		}
+	}
+	for _, userID := range h.Moderators {
+		if slices.Contains(selected, userID) {
+			continue
+		}
+		_, errRemove := queries.RemoveModeratorQuery{}.Do(ab.GetQueryDeps(), store.RemoveModeratorParams{HubID: h.ID, UserID: userID})
+		if errRemove != nil {
+			log.Printf("Error removing moderator: %v\n", errRemove)
+		}
+	}
+	ab.refreshSettings(s, i, h.ID)
+}
+
+func (ab *AgoraBot) editDetails(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	respondModal(s, i, customID(settingsDetailsModalID, h.ID.Hex()), "Hub details",
+		discordgo.TextInput{
+			CustomID:  "name",
+			Label:     "Name",
+			Style:     discordgo.TextInputShort,
+			Value:     h.Name,
+			Required:  true,
+			MaxLength: 100,
+		},
+		discordgo.TextInput{
+			CustomID:  "description",
+			Label:     "Description",
+			Style:     discordgo.TextInputParagraph,
+			Value:     h.Description,
+			MaxLength: 300,
+		},
+	)
+}
+
+func (ab *AgoraBot) saveDetails(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	values := modalValues(i.ModalSubmitData())
+	_, errUpdate := queries.UpdateHubDetailsQuery{}.Do(ab.GetQueryDeps(), store.UpdateHubDetailsParams{
+		HubID:       h.ID,
+		Name:        strings.TrimSpace(values["name"]),
+		Description: strings.TrimSpace(values["description"]),
+	})
+	if errUpdate != nil {
+		log.Printf("Error updating hub details: %v\n", errUpdate)
+		respondQueryError(s, i, errUpdate, "The details weren't saved, please try again later.")
+		return
+	}
+	ab.refreshSettings(s, i, h.ID)
+}
+
+func (ab *AgoraBot) editTemplates(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	inputs := make([]discordgo.TextInput, len(templateInputs))
+	for n, input := range templateInputs {
+		inputs[n] = discordgo.TextInput{
+			CustomID:    input.id,
+			Label:       input.label,
+			Style:       discordgo.TextInputParagraph,
+			Placeholder: "Empty for the default format",
+			Value:       *input.template(&h.Settings.Templates),
+			MaxLength:   format.MaxLength,
+		}
+	}
+	respondModal(s, i, customID(settingsTemplatesModalID, h.ID.Hex()), "Message formats", inputs...)
+}
+
+func (ab *AgoraBot) saveTemplates(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	h, ok := ab.settingsHub(s, i, args)
+	if !ok {
+		return
+	}
+
+	values := modalValues(i.ModalSubmitData())
+	for _, input := range templateInputs {
+		*input.template(&h.Settings.Templates) = strings.TrimSpace(values[input.id])
+	}
+	if errValidate := h.Settings.Templates.Validate(); errValidate != nil {
+		respondError(s, i, fmt.Sprintf("The formats weren't saved, the %v.", errValidate))
+		return
+	}
+	ab.saveSettings(s, i, h)
+}
@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxContentLength is the maximum number of characters of a message accepted by Discord.
+const maxContentLength = 2000
+
+// codeFence opens and closes code blocks in markdown.
+const codeFence = "```"
+
+// markdownMarkers are the inline markdown markers which must not be left open at the end of a part.
+var markdownMarkers = []string{"**", "__", "~~", "||", "`"}
+
+// splitContent splits content into parts of at most limit characters.
+// Parts end on line boundaries when possible, then on word boundaries, avoiding to leave inline markdown open.
+// Lines of a code block are kept together; a code block longer than a part is closed at the end
+// of the part and reopened at the start of the next one, with its language.
+// Parts are never blank, but a content made only of blank lines yields a single empty part.
+func splitContent(content string, limit int) []string {
+	if utf8.RuneCountInString(content) <= limit {
+		return []string{content}
+	}
+
+	var parts []string
+	var current strings.Builder
+	fence := "" // opening fence of the code block the current line belongs to, if any
+
+	flush := func() {
+		part := strings.Trim(current.String(), "\n")
+		if fence != "" {
+			part += "\n" + codeFence
+		}
+		// Discord rejects blank messages, which runs of empty lines would otherwise produce
+		if strings.TrimSpace(part) != "" {
+			parts = append(parts, part)
+		}
+		current.Reset()
+		if fence != "" {
+			current.WriteString(fence + "\n")
+		}
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	for i, line := range lines {
+		// Room kept to close an open code block at the end of the part
+		reserve := 0
+		if fence != "" {
+			reserve = len(codeFence) + 1
+		}
+
+		// Start a code block which fits in a part in a new part rather than splitting it
+		length := utf8.RuneCountInString(line)
+		if fence == "" && togglesFence(line) {
+			length = codeBlockLength(lines[i:])
+			if length > limit {
+				length = utf8.RuneCountInString(line)
+			}
+		}
+
+		if utf8.RuneCountInString(current.String())+length+reserve > limit && current.Len() > len(fence)+1 {
+			flush()
+		}
+
+		for utf8.RuneCountInString(current.String())+utf8.RuneCountInString(line)+reserve > limit {
+			room := limit - utf8.RuneCountInString(current.String()) - reserve
+			head, tail := splitLine(line, room)
+			current.WriteString(head)
+			line = tail
+			flush()
+		}
+
+		current.WriteString(line)
+
+		if togglesFence(line) {
+			if fence == "" {
+				fence = strings.TrimSpace(line)
+			} else {
+				fence = ""
+			}
+		}
+	}
+
+	if current.Len() > 0 {
+		fence = ""
+		flush()
+	}
+
+	// The first part carries the embeds and files of the message, even without content
+	if len(parts) == 0 {
+		return []string{""}
+	}
+	return parts
+}
+
+// togglesFence reports whether a line opens or closes a code block.
+// A line holding a whole code block, such as ```code```, leaves the state unchanged.
+func togglesFence(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, codeFence) && strings.Count(trimmed, codeFence)%2 == 1
+}
+
+// codeBlockLength returns the number of characters of the code block opened by the first of the given lines.
+func codeBlockLength(lines []string) int {
+	length := 0
+	for i, line := range lines {
+		length += utf8.RuneCountInString(line)
+		if i > 0 && togglesFence(line) {
+			break
+		}
+	}
+	return length
+}
+
+// splitLine splits a line too long for a part into a head of at most room characters and the remaining tail.
+// The line is split on the last space which leaves no inline markdown open, or on the last space, or hard as a last resort.
+func splitLine(line string, room int) (string, string) {
+	runes := []rune(line)
+	if room <= 0 {
+		room = 1
+	}
+	if len(runes) <= room {
+		return line, ""
+	}
+
+	fallback := -1
+	for i := room; i > 0; i-- {
+		if runes[i] != ' ' {
+			continue
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+		if isMarkdownBalanced(string(runes[:i])) {
+			return string(runes[:i]), string(runes[i+1:])
+		}
+	}
+
+	if fallback > 0 {
+		return string(runes[:fallback]), string(runes[fallback+1:])
+	}
+	return string(runes[:room]), string(runes[room:])
+}
+
+// isMarkdownBalanced reports whether text leaves no inline markdown marker open.
+func isMarkdownBalanced(text string) bool {
+	for _, marker := range markdownMarkers {
+		if strings.Count(text, marker)%2 != 0 {
+			return false
+		}
+	}
+	return true
+}
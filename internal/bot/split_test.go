@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitContent(t *testing.T) {
+	codeLines := strings.Repeat("fmt.Println(\"relayed\")\n", 150)
+
+	tests := []struct {
+		name    string
+		content string
+		limit   int
+		parts   []string // expected parts, checked only when set
+		check   func(t *testing.T, parts []string)
+	}{
+		{
+			name:    "short content",
+			content: "hello",
+			limit:   maxContentLength,
+			parts:   []string{"hello"},
+		},
+		{
+			name:    "only newlines",
+			content: strings.Repeat("\n", 3000),
+			limit:   maxContentLength,
+			parts:   []string{""},
+		},
+		{
+			name:    "blank lines between text",
+			content: "first" + strings.Repeat("\n", 3000) + "last",
+			limit:   maxContentLength,
+			parts:   []string{"first", "last"},
+		},
+		{
+			name:    "lines",
+			content: "one\ntwo\nthree\nfour",
+			limit:   9,
+			parts:   []string{"one\ntwo", "three", "four"},
+		},
+		{
+			name:    "long unbroken line",
+			content: strings.Repeat("a", 4500),
+			limit:   maxContentLength,
+			parts:   []string{strings.Repeat("a", 2000), strings.Repeat("a", 2000), strings.Repeat("a", 500)},
+		},
+		{
+			name:    "words",
+			content: "lorem ipsum dolor sit amet",
+			limit:   12,
+			parts:   []string{"lorem ipsum", "dolor sit", "amet"},
+		},
+		{
+			name:    "multibyte text",
+			content: strings.Repeat("é", 2500),
+			limit:   maxContentLength,
+			parts:   []string{strings.Repeat("é", 2000), strings.Repeat("é", 500)},
+		},
+		{
+			name:    "multibyte words",
+			content: strings.Repeat("日本語 ", 1000),
+			limit:   maxContentLength,
+			check: func(t *testing.T, parts []string) {
+				if got := strings.Join(parts, " "); got != strings.Repeat("日本語 ", 1000) {
+					t.Errorf("words were cut or lost across parts")
+				}
+			},
+		},
+		{
+			name:    "unbalanced markdown",
+			content: strings.Repeat("**bold words** ", 200),
+			limit:   maxContentLength,
+			check: func(t *testing.T, parts []string) {
+				for n, part := range parts {
+					if !isMarkdownBalanced(part) {
+						t.Errorf("part %d leaves markdown open: %q", n, part)
+					}
+				}
+			},
+		},
+		{
+			name:    "code block across parts",
+			content: "Look:\n```go\n" + codeLines + "```\ndone",
+			limit:   maxContentLength,
+			check: func(t *testing.T, parts []string) {
+				if len(parts) < 2 {
+					t.Fatalf("got %d parts, want the code block split", len(parts))
+				}
+				for n, part := range parts {
+					if strings.Count(part, codeFence)%2 != 0 {
+						t.Errorf("part %d leaves a code block open: %q", n, part)
+					}
+					if n > 0 && n < len(parts)-1 && !strings.HasPrefix(part, "```go\n") {
+						t.Errorf("part %d doesn't reopen the code block with its language: %q", n, part)
+					}
+				}
+			},
+		},
+		{
+			name:    "inline code block",
+			content: "```x```\n" + strings.Repeat("text\n", 500),
+			limit:   maxContentLength,
+			check: func(t *testing.T, parts []string) {
+				if len(parts) < 2 {
+					t.Fatalf("got %d parts, want the content split", len(parts))
+				}
+				for n, part := range parts {
+					if strings.Count(part, codeFence)%2 != 0 {
+						t.Errorf("part %d leaves a code block open: %q", n, part)
+					}
+					if n > 0 && strings.Contains(part, codeFence) {
+						t.Errorf("part %d reopens a closed code block: %q", n, part)
+					}
+				}
+			},
+		},
+		{
+			name:    "code block kept whole",
+			content: strings.Repeat("text\n", 400) + "```\nshort\nblock\n```",
+			limit:   maxContentLength,
+			check: func(t *testing.T, parts []string) {
+				if last := parts[len(parts)-1]; last != "```\nshort\nblock\n```" {
+					t.Errorf("code block was split: %q", last)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := splitContent(tt.content, tt.limit)
+
+			if len(parts) == 0 {
+				t.Fatal("got no parts")
+			}
+			for n, part := range parts {
+				if length := utf8.RuneCountInString(part); length > tt.limit {
+					t.Errorf("part %d has %d characters, want at most %d", n, length, tt.limit)
+				}
+				if len(parts) > 1 && strings.TrimSpace(part) == "" {
+					t.Errorf("part %d is blank", n)
+				}
+				if !utf8.ValidString(part) {
+					t.Errorf("part %d isn't valid UTF-8", n)
+				}
+			}
+
+			if tt.parts != nil {
+				if len(parts) != len(tt.parts) {
+					t.Fatalf("got %d parts %q, want %d parts %q", len(parts), parts, len(tt.parts), tt.parts)
+				}
+				for n := range parts {
+					if parts[n] != tt.parts[n] {
+						t.Errorf("part %d is %q, want %q", n, parts[n], tt.parts[n])
+					}
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, parts)
+			}
+		})
+	}
+}
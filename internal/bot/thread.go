@@ -0,0 +1,338 @@
+package bot
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// channelHub returns the hub a channel belongs to, along with the channels the messages sent in it are relayed to.
+// Mirrored threads relay to their linked threads, hub channels to the other channels of the hub,
+// except forums which only receive messages in their posts.
+func (ab *AgoraBot) channelHub(s *discordgo.Session, channelID string) (hub.Hub, []string, error) {
+	// Only threads can be linked, the lookup is skipped for the channels known not to be threads
+	errThread := store.ErrNotFound
+	var tl link.ThreadLink
+	if channel, errChannel := s.State.Channel(channelID); errChannel != nil || channel.IsThread() {
+		tl, errThread = queries.GetThreadLinkQuery{}.Do(ab.GetQueryDeps(), store.GetThreadLinkParams{ThreadID: channelID})
+		if errThread != nil && !errors.Is(errThread, store.ErrNotFound) {
+			return hub.Hub{}, nil, errThread
+		}
+	}
+
+	if errThread == nil {
+		h, errHub := queries.GetHubQuery{}.Do(ab.GetQueryDeps(), store.GetHubParams{ID: tl.HubID})
+		if errHub != nil {
+			return hub.Hub{}, nil, errHub
+		}
+		return h, otherChannels(tl.ThreadIDs(), channelID), nil
+	}
+
+	h, errHub := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: channelID})
+	if errHub != nil {
+		return hub.Hub{}, nil, errHub
+	}
+
+	var targets []string
+	for _, targetChannelID := range otherChannels(h.Channels, channelID) {
+		if !isForumChannel(s, targetChannelID) {
+			targets = append(targets, targetChannelID)
+		}
+	}
+	return h, targets, nil
+}
+
+// otherChannels returns the given channels except one.
+func otherChannels(channelIDs []string, except string) []string {
+	var others []string
+	for _, channelID := range channelIDs {
+		if channelID != except {
+			others = append(others, channelID)
+		}
+	}
+	return others
+}
+
+// getChannel returns a channel from the state cache, fetching it from Discord when it isn't cached.
+func getChannel(s *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	channel, errChannel := s.State.Channel(channelID)
+	if errChannel == nil {
+		return channel, nil
+	}
+	return s.Channel(channelID)
+}
+
+// webhookChannel returns the channel owning the webhooks usable in a channel,
+// along with the thread to post into when the channel is a thread.
+func webhookChannel(s *discordgo.Session, channelID string) (string, string) {
+	channel, errChannel := getChannel(s, channelID)
+	if errChannel != nil {
+		return channelID, ""
+	}
+
+	if channel.IsThread() {
+		return channel.ParentID, channel.ID
+	}
+	return channelID, ""
+}
+
+// handleThreadCreate mirrors the public threads and forum posts created under a hub channel under the other channels of the hub
+func (ab *AgoraBot) handleThreadCreate(s *discordgo.Session, t *discordgo.ThreadCreate) {
+	// The event is also sent when the bot is added to an existing thread
+	if !t.NewlyCreated {
+		return
+	}
+
+	// Ignore the mirrors created by the bot itself, and private threads which stay private
+	if t.OwnerID == s.State.User.ID || t.Type == discordgo.ChannelTypeGuildPrivateThread {
+		return
+	}
+
+	// Check if the parent channel is in any hub
+	h, errHub := queries.GetHubOfChannelQuery{}.Do(ab.GetQueryDeps(), store.GetHubOfChannelParams{ChannelID: t.ParentID})
+	if errHub != nil {
+		if !errors.Is(errHub, store.ErrNotFound) {
+			log.Printf("Error getting hub of channel: %v\n", errHub)
+		}
+		return
+	}
+
+	// Mirrors posted through the bot's webhook are owned by the webhook, and mirrors are already linked
+	if ab.isOwnWebhook(s, t.ParentID, t.OwnerID) {
+		return
+	}
+	_, errExisting := queries.GetThreadLinkQuery{}.Do(ab.GetQueryDeps(), store.GetThreadLinkParams{ThreadID: t.ID})
+	if errExisting == nil {
+		return
+	}
+
+	// The starter message of a forum post is relayed along with the post, it lives in the post and shares its ID
+	fromForum := isForumChannel(s, t.ParentID)
+	var starterMessage *discordgo.Message
+	if fromForum {
+		m, errMessage := s.ChannelMessage(t.ID, t.ID)
+		if errMessage != nil {
+			log.Printf("Error getting starter message of post %s: %v\n", t.ID, errMessage)
+		} else {
+			m.GuildID = t.GuildID
+			if !ab.shouldRelay(h, m) {
+				return
+			}
+			starterMessage = m
+		}
+	}
+
+	// Join the thread to receive its messages
+	if errJoin := s.ThreadJoin(t.ID); errJoin != nil {
+		log.Printf("Error joining thread %s: %v\n", t.ID, errJoin)
+	}
+
+	_, errLink := queries.AddThreadLinkQuery{}.Do(ab.GetQueryDeps(), store.AddThreadLinkParams{
+		Link: link.ThreadLink{
+			OriginThreadID: t.ID,
+			OriginParentID: t.ParentID,
+			HubID:          h.ID,
+			CreatedAt:      time.Now(),
+		},
+	})
+	if errLink != nil {
+		log.Printf("Error recording thread link: %v\n", errLink)
+		return
+	}
+
+	var starter *relay
+	if starterMessage != nil {
+		starter = ab.forumStarter(s, h, starterMessage)
+	}
+
+	// Posts mirroring a thread of a text channel start from the message the thread was started from, fetched once needed
+	postStarter := starter
+	fetched := fromForum
+
+	// Queued on the parent channels, after the relay of the message the thread may start from
+	for _, targetChannelID := range otherChannels(h.Channels, t.ParentID) {
+		targetChannelID := targetChannelID
+
+		target, errTarget := getChannel(s, targetChannelID)
+		if errTarget != nil {
+			log.Printf("Error getting channel %s: %v\n", targetChannelID, errTarget)
+			continue
+		}
+
+		if isForum(target) {
+			if !fetched {
+				postStarter, fetched = ab.threadStarter(s, h, t.Channel), true
+			}
+			rl := postStarter
+			ab.dispatcher.Enqueue(targetChannelID, func() error {
+				return ab.mirrorPost(s, t.Channel, rl, target)
+			}, logFailure("mirroring thread %s in forum %s", t.ID, targetChannelID))
+			continue
+		}
+
+		// Threads in text channels start from the copy of the post's starter message
+		if starter != nil {
+			ab.enqueueRelay(s, h, targetChannelID, starter, true, 0)
+		}
+		ab.dispatcher.Enqueue(targetChannelID, func() error {
+			return ab.mirrorThread(s, t.Channel, targetChannelID)
+		}, logFailure("mirroring thread %s in channel %s", t.ID, targetChannelID))
+	}
+}
+
+// forumStarter records the link of the starter message of a forum post and prepares its relay.
+// It returns nil when the link cannot be recorded.
+func (ab *AgoraBot) forumStarter(s *discordgo.Session, h hub.Hub, m *discordgo.Message) *relay {
+	_, errLink := queries.AddMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.AddMessageLinkParams{
+		Link: link.MessageLink{
+			OriginMessageID: m.ID,
+			OriginChannelID: m.ChannelID,
+			OriginGuildID:   m.GuildID,
+			HubID:           h.ID,
+			CreatedAt:       time.Now(),
+		},
+	})
+	if errLink != nil {
+		log.Printf("Error recording message link: %v\n", errLink)
+		return nil
+	}
+
+	return ab.newRelay(h, m, true)
+}
+
+// threadStarter prepares the relay of the message a thread of a text channel was started from.
+// It returns nil when the thread wasn't started from a message.
+func (ab *AgoraBot) threadStarter(s *discordgo.Session, h hub.Hub, t *discordgo.Channel) *relay {
+	m, errMessage := s.ChannelMessage(t.ParentID, t.ID)
+	if errMessage != nil {
+		return nil
+	}
+	m.GuildID = t.GuildID
+	return ab.newRelay(h, m, true)
+}
+
+// mirrorPost creates the mirror of a thread as a post of the target forum and records it in the thread link.
+func (ab *AgoraBot) mirrorPost(s *discordgo.Session, t *discordgo.Channel, rl *relay, target *discordgo.Channel) error {
+	postID, errPost := ab.startForumPost(s, t, rl, target)
+	if errPost != nil {
+		return errPost
+	}
+
+	_, errMirror := queries.AddThreadMirrorQuery{}.Do(ab.GetQueryDeps(), store.AddThreadMirrorParams{
+		OriginThreadID: t.ID,
+		Mirror: link.ThreadMirror{
+			ParentID: target.ID,
+			ThreadID: postID,
+		},
+	})
+	return errMirror
+}
+
+// mirrorThread creates the mirror of a thread under the target channel and records it in the thread link.
+func (ab *AgoraBot) mirrorThread(s *discordgo.Session, t *discordgo.Channel, targetChannelID string) error {
+	data := &discordgo.ThreadStart{
+		Name: t.Name,
+		Type: discordgo.ChannelTypeGuildPublicThread,
+	}
+	if t.ThreadMetadata != nil {
+		data.AutoArchiveDuration = t.ThreadMetadata.AutoArchiveDuration
+	}
+	if target, errTarget := s.State.Channel(targetChannelID); errTarget == nil && target.Type == discordgo.ChannelTypeGuildNews {
+		data.Type = discordgo.ChannelTypeGuildNewsThread
+	}
+
+	// A thread started from a message shares its ID, the mirror is started from the copy of that message
+	var created *discordgo.Channel
+	var errStart error
+	l, errLink := queries.GetMessageLinkQuery{}.Do(ab.GetQueryDeps(), store.GetMessageLinkParams{MessageID: t.ID})
+	if messageID, ok := l.MessageIn(targetChannelID); errLink == nil && ok {
+		created, errStart = s.MessageThreadStartComplex(targetChannelID, messageID, data, deliveryOptions...)
+	} else {
+		created, errStart = s.ThreadStartComplex(targetChannelID, data, deliveryOptions...)
+	}
+	if errStart != nil {
+		return errStart
+	}
+
+	_, errMirror := queries.AddThreadMirrorQuery{}.Do(ab.GetQueryDeps(), store.AddThreadMirrorParams{
+		OriginThreadID: t.ID,
+		Mirror: link.ThreadMirror{
+			ParentID: targetChannelID,
+			ThreadID: created.ID,
+		},
+	})
+	return errMirror
+}
+
+// handleThreadUpdate applies the name, archive, lock and tag changes of an original thread to its mirrors
+func (ab *AgoraBot) handleThreadUpdate(s *discordgo.Session, t *discordgo.ThreadUpdate) {
+	tl, errLink := queries.GetThreadLinkQuery{}.Do(ab.GetQueryDeps(), store.GetThreadLinkParams{ThreadID: t.ID})
+	if errLink != nil {
+		if !errors.Is(errLink, store.ErrNotFound) {
+			log.Printf("Error getting thread link: %v\n", errLink)
+		}
+		return
+	}
+
+	// Only changes of the original thread are propagated, changes of mirrors come from the bot
+	if tl.OriginThreadID != t.ID || t.ThreadMetadata == nil {
+		return
+	}
+
+	name := t.Name
+	archived := t.ThreadMetadata.Archived
+	locked := t.ThreadMetadata.Locked
+
+	if before := t.BeforeUpdate; before != nil && before.ThreadMetadata != nil &&
+		before.Name == name && before.ThreadMetadata.Archived == archived && before.ThreadMetadata.Locked == locked &&
+		slices.Equal(before.AppliedTags, t.AppliedTags) {
+		return
+	}
+
+	for _, mirror := range tl.Threads {
+		mirror := mirror
+		edit := &discordgo.ChannelEdit{
+			Name:     name,
+			Archived: &archived,
+			Locked:   &locked,
+		}
+
+		// Tags are mapped by name between forums
+		if parent, errParent := getChannel(s, mirror.ParentID); errParent == nil && isForum(parent) {
+			if tags := forumTags(s, t.Channel, parent); tags != nil {
+				edit.AppliedTags = &tags
+			}
+		}
+
+		ab.dispatcher.Enqueue(mirror.ThreadID, func() error {
+			_, err := s.ChannelEditComplex(mirror.ThreadID, edit, deliveryOptions...)
+			return err
+		}, logFailure("syncing thread %s", mirror.ThreadID))
+	}
+}
+
+// handleThreadDelete forgets the link of a deleted original thread, its mirrors being left to their guilds,
+// or drops a deleted mirror from the link of its original thread
+func (ab *AgoraBot) handleThreadDelete(s *discordgo.Session, t *discordgo.ThreadDelete) {
+	deleted, errDelete := queries.DeleteThreadLinkQuery{}.Do(ab.GetQueryDeps(), store.DeleteThreadLinkParams{OriginThreadID: t.ID})
+	if errDelete != nil {
+		log.Printf("Error deleting thread link: %v\n", errDelete)
+		return
+	}
+	if deleted {
+		return
+	}
+
+	// The deleted thread may be a mirror, whose copies of new messages would fail from now on
+	_, errMirror := queries.DeleteThreadMirrorQuery{}.Do(ab.GetQueryDeps(), store.DeleteThreadMirrorParams{ThreadID: t.ID})
+	if errMirror != nil {
+		log.Printf("Error deleting thread mirror: %v\n", errMirror)
+	}
+}
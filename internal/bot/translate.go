@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var (
+	channelRefRegex = regexp.MustCompile(`<#(\d+)>`)
+	emojiRefRegex   = regexp.MustCompile(`<(a?):(\w+):(\d+)>`)
+)
+
+// translateReferences rewrites the channel and custom emoji references of a relayed message for the target channel.
+// Mentions of hub channels point to the hub channel of the target, which is their local equivalent, and mentions of
+// channels unknown to the target guild are replaced by their name. Custom emojis from other guilds are
+// replaced by their name, or by a link to their image when the hub enables it.
+func translateReferences(s *discordgo.Session, rl *relay, content string, targetChannelID string, targetGuildID string) string {
+	// Copies relayed into a thread mention the hub channel the thread lives under
+	targetHubChannelID, _ := webhookChannel(s, targetChannelID)
+
+	content = channelRefRegex.ReplaceAllStringFunc(content, func(ref string) string {
+		channelID := channelRefRegex.FindStringSubmatch(ref)[1]
+
+		for _, hubChannelID := range rl.hub.Channels {
+			if hubChannelID == channelID {
+				return "<#" + targetHubChannelID + ">"
+			}
+		}
+
+		channel, errChannel := s.State.Channel(channelID)
+		if errChannel != nil {
+			return "#unknown-channel"
+		}
+		if channel.GuildID == targetGuildID {
+			return ref
+		}
+		return "#" + channel.Name
+	})
+
+	content = emojiRefRegex.ReplaceAllStringFunc(content, func(ref string) string {
+		parts := emojiRefRegex.FindStringSubmatch(ref)
+		animated, name, emojiID := parts[1] == "a", parts[2], parts[3]
+
+		if _, errEmoji := s.State.Emoji(targetGuildID, emojiID); errEmoji == nil {
+			return ref
+		}
+
+		if !rl.hub.Settings.EmojiImages {
+			return ":" + name + ":"
+		}
+
+		extension := "png"
+		if animated {
+			extension = "gif"
+		}
+		return fmt.Sprintf("[:%s:](https://cdn.discordapp.com/emojis/%s.%s?size=48)", name, emojiID, extension)
+	})
+
+	return content
+}
+
+// channelLabel returns a readable label for a channel, usable in any guild.
+func channelLabel(s *discordgo.Session, channelID string) string {
+	channel, errChannel := s.State.Channel(channelID)
+	if errChannel != nil {
+		return "#unknown-channel"
+	}
+
+	guild, errGuild := s.State.Guild(channel.GuildID)
+	if errGuild != nil {
+		return "#" + channel.Name
+	}
+	return fmt.Sprintf("#%s in %s", channel.Name, guild.Name)
+}
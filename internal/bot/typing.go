@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// typingInterval is how often the bot may type in a channel, Discord showing a typing indicator for about ten seconds.
+const typingInterval = 8 * time.Second
+
+// typingDebouncer limits how often the bot triggers the typing indicator of each channel.
+type typingDebouncer struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newTypingDebouncer() *typingDebouncer {
+	return &typingDebouncer{last: make(map[string]time.Time)}
+}
+
+// allow reports whether the bot may type in the channel now, and records it when it may.
+func (d *typingDebouncer) allow(channelID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.last[channelID]) < typingInterval {
+		return false
+	}
+	d.last[channelID] = now
+
+	// Forget the channels the bot stopped typing in
+	for id, at := range d.last {
+		if now.Sub(at) >= typingInterval {
+			delete(d.last, id)
+		}
+	}
+	return true
+}
+
+// handleTypingStart relays typing indicators to the other channels of the hub
+func (ab *AgoraBot) handleTypingStart(s *discordgo.Session, t *discordgo.TypingStart) {
+	// Ignore the bot itself and other bridges
+	if t.UserID == s.State.User.ID || slices.Contains(ab.Conf.BridgeBotIDs, t.UserID) {
+		return
+	}
+
+	// Typing is frequent, channels outside of hubs are ignored silently
+	h, targets, errHub := ab.channelHub(s, t.ChannelID)
+	if errHub != nil {
+		return
+	}
+
+	// Bots only type across the hub when their messages are relayed
+	if member, errMember := s.State.Member(t.GuildID, t.UserID); errMember == nil && member.User != nil && member.User.Bot && !h.Settings.RelayBots {
+		return
+	}
+
+	// Typing indicators are best effort, they are neither queued nor retried
+	for _, targetChannelID := range targets {
+		if !ab.typing.allow(targetChannelID) {
+			continue
+		}
+		if errTyping := s.ChannelTyping(targetChannelID, deliveryOptions...); errTyping != nil {
+			log.Printf("Error typing in channel %s: %v\n", targetChannelID, errTyping)
+		}
+	}
+}
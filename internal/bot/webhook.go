@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/maaxleq/agora-bot/internal/query/queries"
+	"github.com/maaxleq/agora-bot/internal/store"
+	"github.com/maaxleq/agora-bot/internal/webhook"
+)
+
+// webhookName is the name given to the webhooks created by the bot in hub channels.
+const webhookName = "Agora"
+
+// maxWebhookUsernameLength is the maximum length of a webhook username accepted by Discord.
+const maxWebhookUsernameLength = 80
+
+// forbiddenUsernameWords are rejected by Discord anywhere in a webhook username, regardless of case.
+var forbiddenUsernameWords = regexp.MustCompile(`(?i)discord|clyde`)
+
+// usernameMarkup is stripped from webhook usernames, Discord rejecting the names containing it.
+var usernameMarkup = strings.NewReplacer("@", "", "#", "", ":", "", "```", "")
+
+// getWebhook returns the webhook used to relay messages into the given channel,
+// reusing a webhook previously created by the bot or creating a new one if needed.
+func (ab *AgoraBot) getWebhook(s *discordgo.Session, channelID string) (webhook.Webhook, error) {
+	wh, errGet := queries.GetWebhookQuery{}.Do(ab.GetQueryDeps(), store.GetWebhookParams{ChannelID: channelID})
+	if errGet == nil {
+		return wh, nil
+	}
+	if !errors.Is(errGet, store.ErrNotFound) {
+		return webhook.Webhook{}, errGet
+	}
+
+	// Prevent concurrent relays from creating several webhooks for the same channel
+	ab.webhookMu.Lock()
+	defer ab.webhookMu.Unlock()
+
+	wh, errGet = queries.GetWebhookQuery{}.Do(ab.GetQueryDeps(), store.GetWebhookParams{ChannelID: channelID})
+	if errGet == nil {
+		return wh, nil
+	}
+
+	hooks, errHooks := s.ChannelWebhooks(channelID)
+	if errHooks != nil {
+		return webhook.Webhook{}, fmt.Errorf("error listing webhooks of channel %s: %w", channelID, errHooks)
+	}
+
+	var found *discordgo.Webhook
+	for _, hook := range hooks {
+		if hook.User != nil && hook.User.ID == s.State.User.ID && hook.Name == webhookName && hook.Token != "" {
+			found = hook
+			break
+		}
+	}
+
+	if found == nil {
+		created, errCreate := s.WebhookCreate(channelID, webhookName, "")
+		if errCreate != nil {
+			return webhook.Webhook{}, fmt.Errorf("error creating webhook in channel %s: %w", channelID, errCreate)
+		}
+		found = created
+	}
+
+	wh = webhook.Webhook{
+		ChannelID: channelID,
+		ID:        found.ID,
+		Token:     found.Token,
+	}
+
+	_, errSet := queries.SetWebhookQuery{}.Do(ab.GetQueryDeps(), store.SetWebhookParams{Webhook: wh})
+	if errSet != nil {
+		return webhook.Webhook{}, errSet
+	}
+
+	return wh, nil
+}
+
+// forgetWebhook removes a webhook that no longer exists on Discord from the store.
+func (ab *AgoraBot) forgetWebhook(channelID string) {
+	_, errDelete := queries.DeleteWebhookQuery{}.Do(ab.GetQueryDeps(), store.DeleteWebhookParams{ChannelID: channelID})
+	if errDelete != nil {
+		log.Printf("Error deleting webhook of channel %s: %v\n", channelID, errDelete)
+	}
+}
+
+// isRESTError reports whether err is a Discord REST error with the given HTTP status or JSON error code.
+func isRESTError(err error, status int, code int) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) {
+		return false
+	}
+	if restErr.Response != nil && restErr.Response.StatusCode == status {
+		return true
+	}
+	return restErr.Message != nil && restErr.Message.Code == code
+}
+
+// isMissingPermissions reports whether err was caused by the bot lacking permissions.
+func isMissingPermissions(err error) bool {
+	return isRESTError(err, http.StatusForbidden, discordgo.ErrCodeMissingPermissions)
+}
+
+// isBadRequest reports whether err was caused by Discord rejecting the content of a request.
+func isBadRequest(err error) bool {
+	return isRESTError(err, http.StatusBadRequest, discordgo.ErrCodeInvalidFormBody)
+}
+
+// isUnknownWebhook reports whether err was caused by a webhook deleted on Discord.
+func isUnknownWebhook(err error) bool {
+	return isRESTError(err, http.StatusNotFound, discordgo.ErrCodeUnknownWebhook)
+}
+
+// authorName returns the name under which the author of a message is displayed.
+func authorName(m *discordgo.Message) string {
+	if m.Member != nil && m.Member.Nick != "" {
+		return m.Member.Nick
+	}
+	if m.Author.GlobalName != "" {
+		return m.Author.GlobalName
+	}
+	return m.Author.Username
+}
+
+// authorAvatarURL returns the avatar under which the author of a message is displayed.
+func authorAvatarURL(m *discordgo.Message) string {
+	if m.Member != nil && m.Member.Avatar != "" {
+		return discordgo.EndpointGuildMemberAvatar(m.GuildID, m.Author.ID, m.Member.Avatar)
+	}
+	return m.Author.AvatarURL("")
+}
+
+// webhookUsername builds the username used to impersonate the author of a relayed message.
+func (ab *AgoraBot) webhookUsername(s *discordgo.Session, m *discordgo.Message) string {
+	username := authorName(m)
+
+	if guild, errGuild := s.State.Guild(m.GuildID); errGuild == nil {
+		username = fmt.Sprintf("%s (%s)", username, guild.Name)
+	}
+
+	username = sanitizeWebhookUsername(username)
+
+	runes := []rune(username)
+	if len(runes) > maxWebhookUsernameLength {
+		username = string(runes[:maxWebhookUsernameLength])
+	}
+
+	return username
+}
+
+// sanitizeWebhookUsername alters a username so that Discord accepts it for a webhook message.
+// The forbidden words are kept readable by swapping a letter for a look-alike digit.
+func sanitizeWebhookUsername(username string) string {
+	username = usernameMarkup.Replace(username)
+	username = forbiddenUsernameWords.ReplaceAllStringFunc(username, func(word string) string {
+		// Case folding may match non-ASCII letters, such as the long s
+		runes := []rune(word)
+		if len(runes) == len("discord") {
+			runes[4] = '0'
+		} else {
+			runes[1] = '1'
+		}
+		return string(runes)
+	})
+
+	username = strings.TrimSpace(username)
+	switch strings.ToLower(username) {
+	case "":
+		return "Unknown"
+	case "everyone", "here":
+		return username + "_"
+	}
+	return username
+}
+
+// isOwnWebhook reports whether the given webhook is the one used by the bot to relay messages into the channel.
+// Messages in threads are sent through the webhook of their parent channel.
+func (ab *AgoraBot) isOwnWebhook(s *discordgo.Session, channelID string, webhookID string) bool {
+	parentID, _ := webhookChannel(s, channelID)
+	wh, errGet := queries.GetWebhookQuery{}.Do(ab.GetQueryDeps(), store.GetWebhookParams{ChannelID: parentID})
+	return errGet == nil && wh.ID == webhookID
+}
+
+// webhookExecute sends a message through a webhook and returns it, threadID being set to send it into a thread of the webhook's channel.
+// The files of the message keep the descriptions of the attachments.
+func webhookExecute(s *discordgo.Session, wh webhook.Webhook, threadID string, params *discordgo.WebhookParams, attachments []uploadAttachment) (*discordgo.Message, error) {
+	if len(params.Files) == 0 {
+		return s.WebhookThreadExecute(wh.ID, wh.Token, true, threadID, params, deliveryOptions...)
+	}
+
+	endpoint := discordgo.EndpointWebhookToken(wh.ID, wh.Token)
+	uri := endpoint + "?wait=true"
+	if threadID != "" {
+		uri += "&thread_id=" + threadID
+	}
+	data := struct {
+		*discordgo.WebhookParams
+		Attachments []uploadAttachment `json:"attachments,omitempty"`
+	}{WebhookParams: params, Attachments: attachments}
+
+	var msg *discordgo.Message
+	errUpload := upload(s, uri, endpoint, data, params.Files, &msg)
+	return msg, errUpload
+}
+
+// webhookMessageEdit edits a message sent by a webhook, threadID being set when the message lives in a thread of the webhook's channel.
+func webhookMessageEdit(s *discordgo.Session, wh webhook.Webhook, threadID string, messageID string, data *discordgo.WebhookEdit) error {
+	if threadID == "" {
+		_, errEdit := s.WebhookMessageEdit(wh.ID, wh.Token, messageID, data, deliveryOptions...)
+		return errEdit
+	}
+
+	// discordgo cannot target a thread when editing webhook messages
+	uri := discordgo.EndpointWebhookMessage(wh.ID, wh.Token, messageID) + "?thread_id=" + threadID
+	_, errEdit := s.RequestWithBucketID(http.MethodPatch, uri, data, discordgo.EndpointWebhookToken("", ""), deliveryOptions...)
+	return errEdit
+}
+
+// webhookMessageDelete deletes a message sent by a webhook, threadID being set when the message lives in a thread of the webhook's channel.
+func webhookMessageDelete(s *discordgo.Session, wh webhook.Webhook, threadID string, messageID string) error {
+	if threadID == "" {
+		return s.WebhookMessageDelete(wh.ID, wh.Token, messageID, deliveryOptions...)
+	}
+
+	// discordgo cannot target a thread when deleting webhook messages
+	uri := discordgo.EndpointWebhookMessage(wh.ID, wh.Token, messageID) + "?thread_id=" + threadID
+	_, errDelete := s.RequestWithBucketID(http.MethodDelete, uri, nil, discordgo.EndpointWebhookToken("", ""), deliveryOptions...)
+	return errDelete
+}
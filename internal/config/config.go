@@ -3,6 +3,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v9"
 	"github.com/joho/godotenv"
@@ -17,6 +18,32 @@ type Config struct {
 	ApiKey            string `env:"AGORA_API_KEY" envDefault:"secret"`
 	DiscordToken      string `env:"AGORA_DISCORD_TOKEN" envDefault:""`
 	StoreType         string `env:"AGORA_STORE_TYPE" envDefault:"memory"`
+	// Duration for which the hub of a channel is cached in front of the store, 0 disabling the cache
+	HubCacheTTL time.Duration `env:"AGORA_HUB_CACHE_TTL" envDefault:"1m"`
+
+	// Duration after which the links between original and mirrored messages and threads expire, 0 keeping them forever
+	MessageLinkTTL time.Duration `env:"AGORA_MESSAGE_LINK_TTL" envDefault:"168h"`
+	// Maximum size in bytes of an attachment re-uploaded with relayed messages, larger ones are linked
+	MaxAttachmentSize int64 `env:"AGORA_MAX_ATTACHMENT_SIZE" envDefault:"8388608"`
+	// Maximum total size in bytes of the attachments re-uploaded with a relayed message, the following ones are linked
+	MaxUploadSize int64 `env:"AGORA_MAX_UPLOAD_SIZE" envDefault:"10485760"`
+	// Duration over which reaction changes are batched before the reaction summaries of digest hubs are updated
+	ReactionDigestWindow time.Duration `env:"AGORA_REACTION_DIGEST_WINDOW" envDefault:"5s"`
+
+	// Loop prevention configuration
+	// IDs of the users or webhooks of other bridge bots, whose messages are never relayed
+	BridgeBotIDs []string `env:"AGORA_BRIDGE_BOT_IDS" envSeparator:","`
+	// Duration during which a bot message repeating relayed content is considered an echo
+	DuplicateWindow time.Duration `env:"AGORA_DUPLICATE_WINDOW" envDefault:"30s"`
+
+	// Outbound dispatcher configuration
+	DispatchWorkers        int           `env:"AGORA_DISPATCH_WORKERS" envDefault:"8"`
+	DispatchQueueSize      int           `env:"AGORA_DISPATCH_QUEUE_SIZE" envDefault:"100"`
+	DispatchEnqueueTimeout time.Duration `env:"AGORA_DISPATCH_ENQUEUE_TIMEOUT" envDefault:"2s"`
+	// Duration after which the queue of a channel without deliveries is stopped, such as the queue of an archived thread
+	DispatchIdleTimeout time.Duration `env:"AGORA_DISPATCH_IDLE_TIMEOUT" envDefault:"10m"`
+	// Maximum number of attempts of a delivery before it is recorded as a dead letter
+	DeliveryMaxAttempts int `env:"AGORA_DELIVERY_MAX_ATTEMPTS" envDefault:"5"`
 
 	// MongoDB configuration
 	MongoURI string `env:"AGORA_MONGO_URI" envDefault:"mongodb://localhost:27017/agora"`
@@ -0,0 +1,33 @@
+package deadletter
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kind is the kind of delivery recorded by a dead letter.
+type Kind string
+
+const (
+	// KindMessage is the relay of an original message into a channel.
+	KindMessage Kind = "message"
+	// KindEdit is the edit of the mirrors of an original message in a channel.
+	KindEdit Kind = "edit"
+)
+
+// DeadLetter records a delivery which failed for good, so that it can be inspected and replayed.
+type DeadLetter struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	HubID           primitive.ObjectID `bson:"hub_id" json:"hub_id"`
+	Kind            Kind               `bson:"kind" json:"kind"`
+	ChannelID       string             `bson:"channel_id" json:"channel_id"`
+	OriginChannelID string             `bson:"origin_channel_id" json:"origin_channel_id"`
+	OriginGuildID   string             `bson:"origin_guild_id" json:"origin_guild_id"`
+	OriginMessageID string             `bson:"origin_message_id" json:"origin_message_id"`
+	// Part is the first part of a relayed copy which wasn't sent.
+	Part      int       `bson:"part" json:"part"`
+	Error     string    `bson:"error" json:"error"`
+	Attempts  int       `bson:"attempts" json:"attempts"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
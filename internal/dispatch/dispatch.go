@@ -0,0 +1,275 @@
+// Package dispatch delivers outbound work to Discord channels through ordered per-channel queues.
+package dispatch
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job is a unit of outbound work targeting a single channel. Jobs returning an error may be retried.
+type Job func() error
+
+// FailureHandler is called with the last error of a job which failed for good and the number of attempts made.
+type FailureHandler func(err error, attempts int)
+
+// RetryPolicy decides, from the error of a job and the number of attempts made, whether and after which delay the job is retried.
+type RetryPolicy func(err error, attempts int) (time.Duration, bool)
+
+// task is a queued job along with its failure handler.
+type task struct {
+	job    Job
+	failed FailureHandler
+}
+
+// Stats holds the metrics of a dispatcher.
+type Stats struct {
+	Enqueued  uint64
+	Delivered uint64
+	Dropped   uint64
+	Retried   uint64
+	Failed    uint64
+	// Depths holds the number of jobs waiting in the queue of each channel
+	Depths map[string]int
+}
+
+// queue is the ordered queue of jobs of a channel.
+type queue struct {
+	tasks chan task
+	// done is closed when the dispatcher closes, releasing the jobs waiting for room in the queue
+	done chan struct{}
+	// senders counts the jobs being enqueued, which keep the queue from being stopped
+	senders atomic.Int64
+}
+
+// Dispatcher runs jobs with one ordered queue per channel and a bounded pool of workers.
+// Jobs of a channel run one at a time in the order they were enqueued, while channels proceed independently.
+type Dispatcher struct {
+	// mu guards the queues map and closed, and is never held while waiting for room in a queue
+	mu      sync.RWMutex
+	queues  map[string]*queue
+	closed  bool
+	wg      sync.WaitGroup
+	senders sync.WaitGroup
+
+	workers        chan struct{}
+	queueSize      int
+	enqueueTimeout time.Duration
+	idleTimeout    time.Duration
+	retry          RetryPolicy
+
+	enqueued  atomic.Uint64
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	retried   atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// New creates a dispatcher running at most workers jobs at once, with queues holding at most queueSize jobs.
+// Enqueuing into a full queue waits up to enqueueTimeout before dropping the job.
+// Queues left empty for idleTimeout are stopped, and started again by the next job of their channel.
+// Failed jobs are retried according to the retry policy.
+func New(workers int, queueSize int, enqueueTimeout time.Duration, idleTimeout time.Duration, retry RetryPolicy) *Dispatcher {
+	return &Dispatcher{
+		queues:         make(map[string]*queue),
+		workers:        make(chan struct{}, workers),
+		queueSize:      queueSize,
+		enqueueTimeout: enqueueTimeout,
+		idleTimeout:    idleTimeout,
+		retry:          retry,
+	}
+}
+
+// Enqueue adds a job to the queue of a channel and reports whether it was accepted.
+// When the queue is full, Enqueue blocks until room is made or the enqueue timeout expires, in which case the job is dropped.
+// Waiting for room only holds up the jobs of the same channel.
+// If the job fails for good, failed is called when not nil.
+func (d *Dispatcher) Enqueue(channelID string, job Job, failed FailureHandler) bool {
+	t := task{job: job, failed: failed}
+
+	q, ok := d.queue(channelID)
+	if !ok {
+		d.dropped.Add(1)
+		return false
+	}
+	defer d.senders.Done()
+	defer q.senders.Add(-1)
+
+	select {
+	case q.tasks <- t:
+		d.enqueued.Add(1)
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(d.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case q.tasks <- t:
+		d.enqueued.Add(1)
+		return true
+	case <-q.done:
+		d.dropped.Add(1)
+		return false
+	case <-timer.C:
+		d.dropped.Add(1)
+		log.Printf("Dropped job for channel %s: queue is full\n", channelID)
+		return false
+	}
+}
+
+// queue returns the queue of a channel, starting it if needed, or false once the dispatcher is closed.
+// The queue is registered as having a sender, which the caller must release once its job is enqueued or dropped.
+func (d *Dispatcher) queue(channelID string) (*queue, bool) {
+	d.mu.RLock()
+	q, ok := d.queues[channelID]
+	if ok && !d.closed {
+		d.register(q)
+		d.mu.RUnlock()
+		return q, true
+	}
+	d.mu.RUnlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, false
+	}
+	// The queue may have been created while the lock was released
+	q, ok = d.queues[channelID]
+	if !ok {
+		q = &queue{
+			tasks: make(chan task, d.queueSize),
+			done:  make(chan struct{}),
+		}
+		d.queues[channelID] = q
+		d.wg.Add(1)
+		go d.run(channelID, q)
+	}
+	d.register(q)
+	return q, true
+}
+
+// register records a sender of a queue. It must be called with the lock held,
+// so that the queue cannot be stopped nor the dispatcher closed in between.
+func (d *Dispatcher) register(q *queue) {
+	q.senders.Add(1)
+	d.senders.Add(1)
+}
+
+// run executes the jobs of a queue in order, and stops the queue once it stays empty for the idle timeout.
+func (d *Dispatcher) run(channelID string, q *queue) {
+	defer d.wg.Done()
+
+	idle := time.NewTimer(d.idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case t, ok := <-q.tasks:
+			if !ok {
+				return
+			}
+			d.deliver(t)
+		case <-idle.C:
+			if d.stopIdle(channelID, q) {
+				return
+			}
+		}
+
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(d.idleTimeout)
+	}
+}
+
+// stopIdle removes a queue from the dispatcher unless it holds jobs or jobs are being enqueued into it.
+// Senders are registered with the lock held, so none can start sending into a removed queue.
+func (d *Dispatcher) stopIdle(channelID string, q *queue) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed || len(q.tasks) > 0 || q.senders.Load() > 0 {
+		return false
+	}
+	delete(d.queues, channelID)
+	return true
+}
+
+// deliver runs a job until it succeeds or the retry policy gives up on it.
+// The job holds a worker while it runs, but not while it waits to be retried,
+// during which the following jobs of its channel wait to preserve ordering.
+func (d *Dispatcher) deliver(t task) {
+	for attempts := 1; ; attempts++ {
+		d.workers <- struct{}{}
+		err := t.job()
+		<-d.workers
+
+		if err == nil {
+			d.delivered.Add(1)
+			return
+		}
+
+		delay, retry := d.retry(err, attempts)
+		if !retry {
+			d.failed.Add(1)
+			if t.failed != nil {
+				t.failed(err, attempts)
+			}
+			return
+		}
+
+		d.retried.Add(1)
+		time.Sleep(delay)
+	}
+}
+
+// Stats returns the current metrics of the dispatcher.
+func (d *Dispatcher) Stats() Stats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	depths := make(map[string]int, len(d.queues))
+	for channelID, q := range d.queues {
+		depths[channelID] = len(q.tasks)
+	}
+
+	return Stats{
+		Enqueued:  d.enqueued.Load(),
+		Delivered: d.delivered.Load(),
+		Dropped:   d.dropped.Load(),
+		Retried:   d.retried.Load(),
+		Failed:    d.failed.Load(),
+		Depths:    depths,
+	}
+}
+
+// Close stops accepting jobs and waits for the queued jobs to be delivered.
+// Jobs still waiting for room in a full queue are dropped.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, q := range d.queues {
+		close(q.done)
+	}
+	d.mu.Unlock()
+
+	// No sender can be registered once closed, so the queues can be closed when the last one is done
+	d.senders.Wait()
+	for _, q := range d.queues {
+		close(q.tasks)
+	}
+
+	d.wg.Wait()
+}
@@ -0,0 +1,179 @@
+package dispatch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func noRetry(err error, attempts int) (time.Duration, bool) {
+	return 0, false
+}
+
+// waitFor polls a condition until it holds or a second passes.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOrderWithinChannel(t *testing.T) {
+	d := New(4, 100, time.Second, time.Minute, noRetry)
+
+	var mu sync.Mutex
+	var order []int
+	for n := 0; n < 100; n++ {
+		n := n
+		d.Enqueue("a", func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, n)
+			return nil
+		}, nil)
+	}
+	d.Close()
+
+	if len(order) != 100 {
+		t.Fatalf("delivered %d jobs, want 100", len(order))
+	}
+	for n, got := range order {
+		if got != n {
+			t.Fatalf("job %d ran at position %d", got, n)
+		}
+	}
+}
+
+func TestChannelsAreIndependent(t *testing.T) {
+	d := New(4, 1, 2*time.Second, time.Minute, noRetry)
+	release := make(chan struct{})
+	defer func() {
+		close(release)
+		d.Close()
+	}()
+
+	// Saturate channel a: one job running, one queued and one waiting for room
+	started := make(chan struct{})
+	d.Enqueue("a", func() error {
+		close(started)
+		<-release
+		return nil
+	}, nil)
+	<-started
+	d.Enqueue("a", func() error { return nil }, nil)
+	go d.Enqueue("a", func() error { return nil }, nil)
+	time.Sleep(10 * time.Millisecond)
+
+	// Starting the queue of another channel needs the write lock, which must not wait for channel a
+	delivered := make(chan struct{})
+	begin := time.Now()
+	if !d.Enqueue("c", func() error {
+		close(delivered)
+		return nil
+	}, nil) {
+		t.Fatal("job of channel c was dropped")
+	}
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("job of channel c wasn't delivered while channel a is full")
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("enqueuing into channel c took %v", elapsed)
+	}
+}
+
+func TestIdleQueueIsStopped(t *testing.T) {
+	d := New(1, 10, time.Second, 10*time.Millisecond, noRetry)
+	defer d.Close()
+
+	d.Enqueue("a", func() error { return nil }, nil)
+	waitFor(t, func() bool {
+		_, ok := d.Stats().Depths["a"]
+		return !ok
+	})
+
+	// The next job of the channel starts its queue again
+	delivered := make(chan struct{})
+	d.Enqueue("a", func() error {
+		close(delivered)
+		return nil
+	}, nil)
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("job enqueued after the queue stopped wasn't delivered")
+	}
+}
+
+func TestDropOnTimeout(t *testing.T) {
+	d := New(1, 1, 20*time.Millisecond, time.Minute, noRetry)
+	release := make(chan struct{})
+	defer func() {
+		close(release)
+		d.Close()
+	}()
+
+	started := make(chan struct{})
+	d.Enqueue("a", func() error {
+		close(started)
+		<-release
+		return nil
+	}, nil)
+	<-started
+	if !d.Enqueue("a", func() error { return nil }, nil) {
+		t.Fatal("job fitting in the queue was dropped")
+	}
+
+	if d.Enqueue("a", func() error { return nil }, nil) {
+		t.Fatal("job enqueued into a full queue was accepted")
+	}
+	if dropped := d.Stats().Dropped; dropped != 1 {
+		t.Errorf("dropped %d jobs, want 1", dropped)
+	}
+}
+
+func TestRetryAndFailure(t *testing.T) {
+	errTransient := errors.New("transient")
+	retryOnce := func(err error, attempts int) (time.Duration, bool) {
+		return time.Millisecond, errors.Is(err, errTransient) && attempts < 2
+	}
+	d := New(1, 10, time.Second, time.Minute, retryOnce)
+
+	calls := 0
+	d.Enqueue("a", func() error {
+		calls++
+		if calls == 1 {
+			return errTransient
+		}
+		return nil
+	}, nil)
+
+	var failedAttempts int
+	d.Enqueue("a", func() error { return errTransient }, func(err error, attempts int) {
+		failedAttempts = attempts
+	})
+	d.Close()
+
+	stats := d.Stats()
+	if stats.Delivered != 1 || stats.Failed != 1 || stats.Retried != 2 {
+		t.Errorf("got %d delivered, %d failed, %d retried, want 1, 1 and 2", stats.Delivered, stats.Failed, stats.Retried)
+	}
+	if failedAttempts != 2 {
+		t.Errorf("failure handler got %d attempts, want 2", failedAttempts)
+	}
+}
+
+func TestEnqueueAfterClose(t *testing.T) {
+	d := New(1, 10, time.Second, time.Minute, noRetry)
+	d.Close()
+
+	if d.Enqueue("a", func() error { return nil }, nil) {
+		t.Fatal("job enqueued after close was accepted")
+	}
+}
@@ -0,0 +1,176 @@
+// Package format renders the text/template formats hub owners customize the bot's messages with.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+)
+
+// MaxLength is the maximum length of a format, and of the text it renders.
+const MaxLength = 500
+
+var errTooLong = fmt.Errorf("rendered text is longer than %d characters", MaxLength)
+
+// Vars holds the variables available to formats.
+// Emoji and MessageURL are only set for reaction notices.
+type Vars struct {
+	Author     string
+	Guild      string
+	Channel    string
+	Hub        string
+	Emoji      string
+	MessageURL string
+}
+
+// funcs are the functions available to formats besides the comparison and logic builtins.
+var funcs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"truncate": func(length int, s string) string {
+		runes := []rune(s)
+		if length < 0 || len(runes) <= length {
+			return s
+		}
+		return string(runes[:length]) + "…"
+	},
+}
+
+// allowedFuncs are the functions a format may call, builtins such as printf or call being left out.
+var allowedFuncs = map[string]bool{
+	"and": true, "or": true, "not": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"upper": true, "lower": true, "truncate": true,
+}
+
+// Validate checks that a format parses, only uses the allowed functions and actions, and renders with sample variables.
+func Validate(text string) error {
+	_, errParse := parseFormat(text)
+	if errParse != nil {
+		return errParse
+	}
+
+	_, errRender := Render(text, Vars{
+		Author:     "author",
+		Guild:      "guild",
+		Channel:    "channel",
+		Hub:        "hub",
+		Emoji:      "👍",
+		MessageURL: "https://discord.com/channels/0/0/0",
+	})
+	return errRender
+}
+
+// Render executes a format with the given variables.
+func Render(text string, vars Vars) (string, error) {
+	tmpl, errParse := parseFormat(text)
+	if errParse != nil {
+		return "", errParse
+	}
+
+	out := &limitedBuffer{limit: MaxLength}
+	if errExec := tmpl.Execute(out, vars); errExec != nil {
+		if errors.Is(errExec, errTooLong) {
+			return "", errTooLong
+		}
+		return "", fmt.Errorf("invalid format: %w", errExec)
+	}
+	return out.String(), nil
+}
+
+func parseFormat(text string) (*template.Template, error) {
+	if utf8.RuneCountInString(text) > MaxLength {
+		return nil, fmt.Errorf("format is longer than %d characters", MaxLength)
+	}
+
+	tmpl, errParse := template.New("format").Option("missingkey=error").Funcs(funcs).Parse(text)
+	if errParse != nil {
+		return nil, fmt.Errorf("invalid format: %w", errParse)
+	}
+
+	// Formats are single templates, they cannot define nor include others
+	if len(tmpl.Templates()) > 1 {
+		return nil, errors.New("invalid format: defining templates is not allowed")
+	}
+	if errCheck := checkNode(tmpl.Tree.Root); errCheck != nil {
+		return nil, fmt.Errorf("invalid format: %w", errCheck)
+	}
+
+	return tmpl, nil
+}
+
+// checkNode walks the parse tree of a format, rejecting the actions and functions formats may not use.
+func checkNode(node parse.Node) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkNode(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkNode(n.Pipe)
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return errors.New("range is not allowed")
+	case *parse.TemplateNode:
+		return errors.New("including templates is not allowed")
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := checkNode(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := checkNode(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.ChainNode:
+		return checkNode(n.Node)
+	case *parse.IdentifierNode:
+		if !allowedFuncs[n.Ident] {
+			return fmt.Errorf("function %s is not allowed", n.Ident)
+		}
+	}
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode) error {
+	if err := checkNode(n.Pipe); err != nil {
+		return err
+	}
+	if err := checkNode(n.List); err != nil {
+		return err
+	}
+	return checkNode(n.ElseList)
+}
+
+// limitedBuffer fails writes growing it past its limit, stopping the execution of a format.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if utf8.RuneCount(b.Bytes())+utf8.RuneCount(p) > b.limit {
+		return 0, errTooLong
+	}
+	return b.Buffer.Write(p)
+}
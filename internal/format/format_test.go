@@ -0,0 +1,91 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{name: "text", format: "New member"},
+		{name: "variables", format: "{{.Author}} joined {{.Hub}} from {{.Guild}} #{{.Channel}}"},
+		{name: "functions", format: "{{upper .Author}} {{lower .Guild}} {{truncate 3 .Hub}}"},
+		{name: "conditions", format: "{{if and .Emoji (ne .Author \"bot\")}}{{.Emoji}}{{else}}none{{end}}"},
+		{name: "with", format: "{{with .MessageURL}}<{{.}}>{{end}}"},
+		{name: "printf", format: "{{printf \"%s\" .Author}}", wantErr: true},
+		{name: "call", format: "{{call .Author}}", wantErr: true},
+		{name: "html", format: "{{html .Author}}", wantErr: true},
+		{name: "range", format: "{{range .Author}}x{{end}}", wantErr: true},
+		{name: "template", format: "{{template \"other\"}}", wantErr: true},
+		{name: "define", format: "{{define \"other\"}}x{{end}}{{.Author}}", wantErr: true},
+		{name: "block", format: "{{block \"other\" .}}x{{end}}", wantErr: true},
+		{name: "function in condition", format: "{{if printf \"x\"}}x{{end}}", wantErr: true},
+		{name: "unknown variable", format: "{{.Password}}", wantErr: true},
+		{name: "syntax error", format: "{{.Author", wantErr: true},
+		{name: "long format", format: strings.Repeat("a", MaxLength+1), wantErr: true},
+		{name: "long output", format: strings.Repeat("{{.MessageURL}}", MaxLength/len("{{.MessageURL}}")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.format)
+			if tt.wantErr && err == nil {
+				t.Errorf("Validate(%q) accepted the format", tt.format)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate(%q) = %v, want no error", tt.format, err)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	vars := Vars{
+		Author:  "Ada",
+		Guild:   "Engines",
+		Channel: "general",
+		Hub:     "Analytical",
+		Emoji:   "👍",
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		vars    Vars
+		want    string
+		wantErr bool
+	}{
+		{name: "variables", format: "{{.Author}} in #{{.Channel}} of {{.Guild}}", vars: vars, want: "Ada in #general of Engines"},
+		{name: "upper", format: "{{upper .Hub}}", vars: vars, want: "ANALYTICAL"},
+		{name: "lower", format: "{{.Author | lower}}", vars: vars, want: "ada"},
+		{name: "truncate", format: "{{truncate 4 .Hub}}", vars: vars, want: "Anal…"},
+		{name: "truncate short", format: "{{truncate 10 .Author}}", vars: vars, want: "Ada"},
+		{name: "condition", format: "{{if .MessageURL}}link{{else}}{{.Emoji}}{{end}}", vars: vars, want: "👍"},
+		{name: "comparison", format: "{{if eq .Author \"Ada\"}}yes{{end}}", vars: vars, want: "yes"},
+		{name: "long output", format: "{{.Author}}", vars: Vars{Author: strings.Repeat("é", MaxLength+1)}, wantErr: true},
+		{name: "output at limit", format: "{{.Author}}", vars: Vars{Author: strings.Repeat("é", MaxLength)}, want: strings.Repeat("é", MaxLength)},
+		{name: "forbidden function", format: "{{printf \"%s\" .Author}}", vars: vars, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.format, tt.vars)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Render(%q) = %q, want an error", tt.format, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render(%q) = %v, want no error", tt.format, err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,8 +3,24 @@ package hub
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Hub struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	OwnerID  string             `bson:"owner_id" json:"owner_id"`
-	Name     string             `bson:"name" json:"name"`
-	Channels []string           `bson:"channels" json:"channels"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	OwnerID     string             `bson:"owner_id" json:"owner_id"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	Channels    []string           `bson:"channels" json:"channels"`
+	Moderators  []string           `bson:"moderators" json:"moderators"`
+	Settings    Settings           `bson:"settings" json:"settings"`
+}
+
+// IsModerator reports whether the given user moderates the hub, the owner being a moderator of their hub.
+func (h Hub) IsModerator(userID string) bool {
+	if userID == h.OwnerID {
+		return true
+	}
+	for _, moderatorID := range h.Moderators {
+		if moderatorID == userID {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,40 @@
+package hub
+
+// ReactionMode defines how reactions to messages are relayed across a hub.
+type ReactionMode string
+
+const (
+	// ReactionModeMirror applies reactions as reactions of the bot on every copy of a message.
+	ReactionModeMirror ReactionMode = "mirror"
+	// ReactionModeAnnounce announces every reaction with a message in the other channels of the hub.
+	ReactionModeAnnounce ReactionMode = "announce"
+	// ReactionModeDigest summarizes the reactions from every guild in an embed of each mirror, updated in batches.
+	ReactionModeDigest ReactionMode = "digest"
+)
+
+// Settings holds the relay options of a hub.
+type Settings struct {
+	ReactionMode ReactionMode `bson:"reaction_mode,omitempty" json:"reaction_mode,omitempty"`
+	// Public lets anyone find the hub and join it, private hubs being joined by their moderators only
+	Public bool `bson:"public" json:"public"`
+	// AllowMemberPings lets relayed messages ping the mentioned users who are members of the target guild
+	AllowMemberPings bool `bson:"allow_member_pings" json:"allow_member_pings"`
+	// EmojiImages replaces custom emojis unavailable in the target guild by a link to their image instead of their name
+	EmojiImages bool `bson:"emoji_images" json:"emoji_images"`
+	// RelayBots relays the messages sent by other bots, which are ignored by default to prevent relay loops
+	RelayBots bool `bson:"relay_bots" json:"relay_bots"`
+	// RelayWebhooks relays the messages sent by webhooks other than the bot's own, which are ignored by default
+	RelayWebhooks bool `bson:"relay_webhooks" json:"relay_webhooks"`
+	// PinsFromModeratorsOnly only syncs the pins and unpins made by moderators of the hub, instead of those made in any guild
+	PinsFromModeratorsOnly bool `bson:"pins_from_moderators_only" json:"pins_from_moderators_only"`
+	// Templates customizes the messages of the bot in the hub
+	Templates Templates `bson:"templates" json:"templates"`
+}
+
+// Reactions returns the reaction mode of the hub, reactions being mirrored by default.
+func (s Settings) Reactions() ReactionMode {
+	if s.ReactionMode == "" {
+		return ReactionModeMirror
+	}
+	return s.ReactionMode
+}
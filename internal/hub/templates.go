@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"fmt"
+
+	"github.com/maaxleq/agora-bot/internal/format"
+)
+
+// Default formats of the messages of the bot, used when a hub doesn't define its own.
+const (
+	DefaultHeader         = "**{{.Author}}** (from #{{.Channel}} in {{.Guild}}):"
+	DefaultReactionAdd    = "**{{.Author}}** reacted with {{.Emoji}} to [a message]({{.MessageURL}}) in #{{.Channel}} in {{.Guild}}"
+	DefaultReactionRemove = "**{{.Author}}** removed their {{.Emoji}} reaction from [a message]({{.MessageURL}}) in #{{.Channel}} in {{.Guild}}"
+	DefaultJoin           = "**#{{.Channel}}** from **{{.Guild}}** joined the hub **{{.Hub}}**"
+	DefaultLeave          = "**#{{.Channel}}** from **{{.Guild}}** left the hub **{{.Hub}}**"
+)
+
+// Templates holds the text/template formats of the messages of the bot in a hub, empty ones falling back to the defaults.
+type Templates struct {
+	// Header precedes the messages relayed by the bot itself, when webhooks cannot be used
+	Header         string `bson:"header,omitempty" json:"header,omitempty"`
+	ReactionAdd    string `bson:"reaction_add,omitempty" json:"reaction_add,omitempty"`
+	ReactionRemove string `bson:"reaction_remove,omitempty" json:"reaction_remove,omitempty"`
+	Join           string `bson:"join,omitempty" json:"join,omitempty"`
+	Leave          string `bson:"leave,omitempty" json:"leave,omitempty"`
+}
+
+// Validate checks every format defined in the templates.
+func (t Templates) Validate() error {
+	formats := []struct {
+		name string
+		text string
+	}{
+		{"header", t.Header},
+		{"reaction add", t.ReactionAdd},
+		{"reaction remove", t.ReactionRemove},
+		{"join", t.Join},
+		{"leave", t.Leave},
+	}
+
+	for _, f := range formats {
+		if f.text == "" {
+			continue
+		}
+		if errValidate := format.Validate(f.text); errValidate != nil {
+			return fmt.Errorf("%s format: %w", f.name, errValidate)
+		}
+	}
+	return nil
+}
+
+// HeaderFormat returns the format of the header of messages relayed by the bot itself.
+func (t Templates) HeaderFormat() string {
+	return orDefault(t.Header, DefaultHeader)
+}
+
+// ReactionFormat returns the format of reaction notices.
+func (t Templates) ReactionFormat(added bool) string {
+	if added {
+		return orDefault(t.ReactionAdd, DefaultReactionAdd)
+	}
+	return orDefault(t.ReactionRemove, DefaultReactionRemove)
+}
+
+// JoinFormat returns the format of the notice of a channel joining the hub.
+func (t Templates) JoinFormat() string {
+	return orDefault(t.Join, DefaultJoin)
+}
+
+// LeaveFormat returns the format of the notice of a channel leaving the hub.
+func (t Templates) LeaveFormat() string {
+	return orDefault(t.Leave, DefaultLeave)
+}
+
+func orDefault(text string, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	return text
+}
@@ -0,0 +1,64 @@
+package link
+
+import (
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mirror is a copy of an original message relayed into another channel of the hub.
+type Mirror struct {
+	ChannelID string `bson:"channel_id" json:"channel_id"`
+	MessageID string `bson:"message_id" json:"message_id"`
+	WebhookID string `bson:"webhook_id,omitempty" json:"webhook_id,omitempty"`
+	// Part is the index of the mirror among the messages a copy was split into
+	Part int `bson:"part" json:"part"`
+}
+
+// MessageLink records every mirrored copy of an original message.
+type MessageLink struct {
+	OriginMessageID string             `bson:"_id" json:"origin_message_id"`
+	OriginChannelID string             `bson:"origin_channel_id" json:"origin_channel_id"`
+	OriginGuildID   string             `bson:"origin_guild_id" json:"origin_guild_id"`
+	HubID           primitive.ObjectID `bson:"hub_id" json:"hub_id"`
+	Mirrors         []Mirror           `bson:"mirrors" json:"mirrors"`
+	// Fingerprint identifies the state of the original message last relayed, so that updates which don't change it are skipped
+	Fingerprint string    `bson:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Reaction records the users reacting with an emoji to any copy of a linked message.
+type Reaction struct {
+	OriginMessageID string    `bson:"origin_message_id" json:"origin_message_id"`
+	Emoji           string    `bson:"emoji" json:"emoji"`
+	UserIDs         []string  `bson:"user_ids" json:"user_ids"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+}
+
+// MessageIn returns the ID of the linked message living in the given channel, be it the original or the first part of a mirror.
+func (l MessageLink) MessageIn(channelID string) (string, bool) {
+	if l.OriginChannelID == channelID {
+		return l.OriginMessageID, true
+	}
+	for _, mirror := range l.Mirrors {
+		if mirror.ChannelID == channelID && mirror.Part == 0 {
+			return mirror.MessageID, true
+		}
+	}
+	return "", false
+}
+
+// MirrorsIn returns the mirrors of the message living in the given channel, ordered by part.
+func (l MessageLink) MirrorsIn(channelID string) []Mirror {
+	var mirrors []Mirror
+	for _, mirror := range l.Mirrors {
+		if mirror.ChannelID == channelID {
+			mirrors = append(mirrors, mirror)
+		}
+	}
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].Part < mirrors[j].Part
+	})
+	return mirrors
+}
@@ -0,0 +1,44 @@
+package link
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ThreadMirror is a thread created by the bot under another channel of the hub to mirror an original thread.
+type ThreadMirror struct {
+	ParentID string `bson:"parent_id" json:"parent_id"`
+	ThreadID string `bson:"thread_id" json:"thread_id"`
+}
+
+// ThreadLink records every mirrored copy of a thread created under a hub channel.
+type ThreadLink struct {
+	OriginThreadID string             `bson:"_id" json:"origin_thread_id"`
+	OriginParentID string             `bson:"origin_parent_id" json:"origin_parent_id"`
+	HubID          primitive.ObjectID `bson:"hub_id" json:"hub_id"`
+	Threads        []ThreadMirror     `bson:"threads" json:"threads"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ThreadIn returns the ID of the linked thread living under the given parent channel, be it the original or a mirror.
+func (l ThreadLink) ThreadIn(parentID string) (string, bool) {
+	if l.OriginParentID == parentID {
+		return l.OriginThreadID, true
+	}
+	for _, mirror := range l.Threads {
+		if mirror.ParentID == parentID {
+			return mirror.ThreadID, true
+		}
+	}
+	return "", false
+}
+
+// ThreadIDs returns the IDs of every copy of the thread, the original included.
+func (l ThreadLink) ThreadIDs() []string {
+	ids := []string{l.OriginThreadID}
+	for _, mirror := range l.Threads {
+		ids = append(ids, mirror.ThreadID)
+	}
+	return ids
+}
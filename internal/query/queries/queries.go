@@ -1,15 +1,28 @@
 package queries
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/maaxleq/agora-bot/internal/deadletter"
 	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
 	"github.com/maaxleq/agora-bot/internal/query"
 	"github.com/maaxleq/agora-bot/internal/store"
+	"github.com/maaxleq/agora-bot/internal/webhook"
 )
 
 var empty struct{}
 
+// Errors of the queries refusing a change, wrapped with its details so that callers can tell users why.
+var (
+	ErrMaxHubs     = errors.New("maximum number of hubs reached")
+	ErrMaxChannels = errors.New("maximum number of channels per hub reached")
+	ErrNameTaken   = errors.New("hub name already taken")
+	ErrEmptyName   = errors.New("hub name is empty")
+)
+
 type AddHubQuery struct{}
 
 func (AddHubQuery) Do(qd query.QueryDeps, params store.AddHubParams) (struct{}, error) {
@@ -19,7 +32,20 @@ func (AddHubQuery) Do(qd query.QueryDeps, params store.AddHubParams) (struct{},
 	}
 
 	if hubsCount >= qd.Conf.MaxHubs {
-		return empty, fmt.Errorf("maximum number of hubs reached")
+		return empty, ErrMaxHubs
+	}
+
+	if strings.TrimSpace(params.Hub.Name) == "" {
+		return empty, ErrEmptyName
+	}
+
+	// Hubs are addressed by name from Discord, so names must be unique regardless of case
+	_, errName := (*qd.Store).GetHubByName(store.GetHubByNameParams{Name: params.Hub.Name})
+	if errName == nil {
+		return empty, fmt.Errorf("a hub named %s already exists: %w", params.Hub.Name, ErrNameTaken)
+	}
+	if !errors.Is(errName, store.ErrNotFound) {
+		return empty, errName
 	}
 
 	err := (*qd.Store).AddHub(params)
@@ -44,6 +70,31 @@ func (GetHubsQuery) Do(qd query.QueryDeps, params store.GetHubsParams) ([]hub.Hu
 	return (*qd.Store).GetHubs(params)
 }
 
+type AddModeratorQuery struct{}
+
+func (AddModeratorQuery) Do(qd query.QueryDeps, params store.AddModeratorParams) (struct{}, error) {
+	err := (*qd.Store).AddModerator(params)
+	return empty, err
+}
+
+type RemoveModeratorQuery struct{}
+
+func (RemoveModeratorQuery) Do(qd query.QueryDeps, params store.RemoveModeratorParams) (bool, error) {
+	return (*qd.Store).RemoveModerator(params)
+}
+
+type GetHubByNameQuery struct{}
+
+func (GetHubByNameQuery) Do(qd query.QueryDeps, params store.GetHubByNameParams) (hub.Hub, error) {
+	return (*qd.Store).GetHubByName(params)
+}
+
+type SearchHubsQuery struct{}
+
+func (SearchHubsQuery) Do(qd query.QueryDeps, params store.SearchHubsParams) ([]hub.Hub, error) {
+	return (*qd.Store).SearchHubs(params)
+}
+
 type AddChannelQuery struct{}
 
 func (AddChannelQuery) Do(qd query.QueryDeps, params store.AddChannelParams) (struct{}, error) {
@@ -53,7 +104,7 @@ func (AddChannelQuery) Do(qd query.QueryDeps, params store.AddChannelParams) (st
 	}
 
 	if channelsCount >= qd.Conf.MaxChannelsPerHub {
-		return empty, fmt.Errorf("maximum number of channels per hub reached")
+		return empty, ErrMaxChannels
 	}
 
 	err := (*qd.Store).AddChannel(store.AddChannelParams{
@@ -69,6 +120,38 @@ func (DeleteChannelQuery) Do(qd query.QueryDeps, params store.DeleteChannelParam
 	return (*qd.Store).DeleteChannel(params)
 }
 
+type UpdateHubSettingsQuery struct{}
+
+func (UpdateHubSettingsQuery) Do(qd query.QueryDeps, params store.UpdateHubSettingsParams) (struct{}, error) {
+	// Formats are validated when saved, so that relaying never runs a broken or unsafe template
+	if errValidate := params.Settings.Templates.Validate(); errValidate != nil {
+		return empty, errValidate
+	}
+
+	err := (*qd.Store).UpdateHubSettings(params)
+	return empty, err
+}
+
+type UpdateHubDetailsQuery struct{}
+
+func (UpdateHubDetailsQuery) Do(qd query.QueryDeps, params store.UpdateHubDetailsParams) (struct{}, error) {
+	if strings.TrimSpace(params.Name) == "" {
+		return empty, ErrEmptyName
+	}
+
+	// Names stay unique regardless of case, the hub keeping its own name with a different case being allowed
+	other, errName := (*qd.Store).GetHubByName(store.GetHubByNameParams{Name: params.Name})
+	if errName == nil && other.ID != params.HubID {
+		return empty, fmt.Errorf("a hub named %s already exists: %w", params.Name, ErrNameTaken)
+	}
+	if errName != nil && !errors.Is(errName, store.ErrNotFound) {
+		return empty, errName
+	}
+
+	err := (*qd.Store).UpdateHubDetails(params)
+	return empty, err
+}
+
 type GetHubsCountQuery struct{}
 
 func (GetHubsCountQuery) Do(qd query.QueryDeps, params store.GetHubsCountParams) (uint, error) {
@@ -86,3 +169,130 @@ type GetHubOfChannelQuery struct{}
 func (GetHubOfChannelQuery) Do(qd query.QueryDeps, params store.GetHubOfChannelParams) (hub.Hub, error) {
 	return (*qd.Store).GetHubOfChannel(params)
 }
+
+type SetWebhookQuery struct{}
+
+func (SetWebhookQuery) Do(qd query.QueryDeps, params store.SetWebhookParams) (struct{}, error) {
+	err := (*qd.Store).SetWebhook(params)
+	return empty, err
+}
+
+type GetWebhookQuery struct{}
+
+func (GetWebhookQuery) Do(qd query.QueryDeps, params store.GetWebhookParams) (webhook.Webhook, error) {
+	return (*qd.Store).GetWebhook(params)
+}
+
+type DeleteWebhookQuery struct{}
+
+func (DeleteWebhookQuery) Do(qd query.QueryDeps, params store.DeleteWebhookParams) (bool, error) {
+	return (*qd.Store).DeleteWebhook(params)
+}
+
+type AddMessageLinkQuery struct{}
+
+func (AddMessageLinkQuery) Do(qd query.QueryDeps, params store.AddMessageLinkParams) (struct{}, error) {
+	err := (*qd.Store).AddMessageLink(params)
+	return empty, err
+}
+
+type AddMirrorQuery struct{}
+
+func (AddMirrorQuery) Do(qd query.QueryDeps, params store.AddMirrorParams) (struct{}, error) {
+	err := (*qd.Store).AddMirror(params)
+	return empty, err
+}
+
+type GetMessageLinkQuery struct{}
+
+func (GetMessageLinkQuery) Do(qd query.QueryDeps, params store.GetMessageLinkParams) (link.MessageLink, error) {
+	return (*qd.Store).GetMessageLink(params)
+}
+
+type SetFingerprintQuery struct{}
+
+func (SetFingerprintQuery) Do(qd query.QueryDeps, params store.SetFingerprintParams) (struct{}, error) {
+	err := (*qd.Store).SetFingerprint(params)
+	return empty, err
+}
+
+type DeleteMirrorQuery struct{}
+
+func (DeleteMirrorQuery) Do(qd query.QueryDeps, params store.DeleteMirrorParams) (bool, error) {
+	return (*qd.Store).DeleteMirror(params)
+}
+
+type DeleteMessageLinkQuery struct{}
+
+func (DeleteMessageLinkQuery) Do(qd query.QueryDeps, params store.DeleteMessageLinkParams) (bool, error) {
+	return (*qd.Store).DeleteMessageLink(params)
+}
+
+type AddReactionQuery struct{}
+
+func (AddReactionQuery) Do(qd query.QueryDeps, params store.AddReactionParams) (uint, error) {
+	return (*qd.Store).AddReaction(params)
+}
+
+type RemoveReactionQuery struct{}
+
+func (RemoveReactionQuery) Do(qd query.QueryDeps, params store.RemoveReactionParams) (uint, error) {
+	return (*qd.Store).RemoveReaction(params)
+}
+
+type GetReactionsQuery struct{}
+
+func (GetReactionsQuery) Do(qd query.QueryDeps, params store.GetReactionsParams) ([]link.Reaction, error) {
+	return (*qd.Store).GetReactions(params)
+}
+
+type AddDeadLetterQuery struct{}
+
+func (AddDeadLetterQuery) Do(qd query.QueryDeps, params store.AddDeadLetterParams) (struct{}, error) {
+	err := (*qd.Store).AddDeadLetter(params)
+	return empty, err
+}
+
+type GetDeadLettersQuery struct{}
+
+func (GetDeadLettersQuery) Do(qd query.QueryDeps, params store.GetDeadLettersParams) ([]deadletter.DeadLetter, error) {
+	return (*qd.Store).GetDeadLetters(params)
+}
+
+type DeleteDeadLetterQuery struct{}
+
+func (DeleteDeadLetterQuery) Do(qd query.QueryDeps, params store.DeleteDeadLetterParams) (bool, error) {
+	return (*qd.Store).DeleteDeadLetter(params)
+}
+
+type AddThreadLinkQuery struct{}
+
+func (AddThreadLinkQuery) Do(qd query.QueryDeps, params store.AddThreadLinkParams) (struct{}, error) {
+	err := (*qd.Store).AddThreadLink(params)
+	return empty, err
+}
+
+type AddThreadMirrorQuery struct{}
+
+func (AddThreadMirrorQuery) Do(qd query.QueryDeps, params store.AddThreadMirrorParams) (struct{}, error) {
+	err := (*qd.Store).AddThreadMirror(params)
+	return empty, err
+}
+
+type GetThreadLinkQuery struct{}
+
+func (GetThreadLinkQuery) Do(qd query.QueryDeps, params store.GetThreadLinkParams) (link.ThreadLink, error) {
+	return (*qd.Store).GetThreadLink(params)
+}
+
+type DeleteThreadLinkQuery struct{}
+
+func (DeleteThreadLinkQuery) Do(qd query.QueryDeps, params store.DeleteThreadLinkParams) (bool, error) {
+	return (*qd.Store).DeleteThreadLink(params)
+}
+
+type DeleteThreadMirrorQuery struct{}
+
+func (DeleteThreadMirrorQuery) Do(qd query.QueryDeps, params store.DeleteThreadMirrorParams) (bool, error) {
+	return (*qd.Store).DeleteThreadMirror(params)
+}
@@ -25,5 +25,10 @@ func LoadStore(config config.Config) (*store.Storer, error) {
 		return nil, err
 	}
 
+	// Hub lookups happen for every event, they are cached in front of the store
+	if config.HubCacheTTL > 0 {
+		store = stores.NewCachedStore(store, config.HubCacheTTL)
+	}
+
 	return &store, nil
 }
@@ -1,11 +1,19 @@
 package store
 
 import (
+	"errors"
+
 	"github.com/maaxleq/agora-bot/internal/config"
+	"github.com/maaxleq/agora-bot/internal/deadletter"
 	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
+	"github.com/maaxleq/agora-bot/internal/webhook"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrNotFound is wrapped by store errors reporting that the requested item does not exist.
+var ErrNotFound = errors.New("not found")
+
 type AddHubParams struct {
 	Hub hub.Hub
 }
@@ -20,6 +28,17 @@ type GetHubParams struct {
 
 type GetHubsParams struct{}
 
+type GetHubByNameParams struct {
+	Name string
+}
+
+type SearchHubsParams struct {
+	// Prefix starts the names of the hubs, regardless of case
+	Prefix string
+	// Limit is the maximum number of hubs returned, 0 returning every match
+	Limit int
+}
+
 type AddChannelParams struct {
 	HubID     primitive.ObjectID
 	ChannelID string
@@ -30,6 +49,27 @@ type DeleteChannelParams struct {
 	ChannelID string
 }
 
+type UpdateHubSettingsParams struct {
+	HubID    primitive.ObjectID
+	Settings hub.Settings
+}
+
+type UpdateHubDetailsParams struct {
+	HubID       primitive.ObjectID
+	Name        string
+	Description string
+}
+
+type AddModeratorParams struct {
+	HubID  primitive.ObjectID
+	UserID string
+}
+
+type RemoveModeratorParams struct {
+	HubID  primitive.ObjectID
+	UserID string
+}
+
 type GetHubsCountParams struct{}
 
 type GetChannelsCountParams struct {
@@ -40,6 +80,95 @@ type GetHubOfChannelParams struct {
 	ChannelID string
 }
 
+type SetWebhookParams struct {
+	Webhook webhook.Webhook
+}
+
+type GetWebhookParams struct {
+	ChannelID string
+}
+
+type DeleteWebhookParams struct {
+	ChannelID string
+}
+
+type AddMessageLinkParams struct {
+	Link link.MessageLink
+}
+
+type AddMirrorParams struct {
+	OriginMessageID string
+	Mirror          link.Mirror
+}
+
+// GetMessageLinkParams looks up the link of a message, MessageID being either the original message or one of its mirrors.
+type GetMessageLinkParams struct {
+	MessageID string
+}
+
+type SetFingerprintParams struct {
+	OriginMessageID string
+	Fingerprint     string
+}
+
+type DeleteMirrorParams struct {
+	MessageID string
+}
+
+type DeleteMessageLinkParams struct {
+	OriginMessageID string
+}
+
+type AddReactionParams struct {
+	OriginMessageID string
+	Emoji           string
+	UserID          string
+}
+
+type RemoveReactionParams struct {
+	OriginMessageID string
+	Emoji           string
+	UserID          string
+}
+
+type GetReactionsParams struct {
+	OriginMessageID string
+}
+
+type AddDeadLetterParams struct {
+	DeadLetter deadletter.DeadLetter
+}
+
+type GetDeadLettersParams struct {
+	HubID primitive.ObjectID
+}
+
+type DeleteDeadLetterParams struct {
+	ID primitive.ObjectID
+}
+
+type AddThreadLinkParams struct {
+	Link link.ThreadLink
+}
+
+type AddThreadMirrorParams struct {
+	OriginThreadID string
+	Mirror         link.ThreadMirror
+}
+
+// GetThreadLinkParams looks up the link of a thread, ThreadID being either the original thread or one of its mirrors.
+type GetThreadLinkParams struct {
+	ThreadID string
+}
+
+type DeleteThreadLinkParams struct {
+	OriginThreadID string
+}
+
+type DeleteThreadMirrorParams struct {
+	ThreadID string
+}
+
 type Storer interface {
 	Configure(config config.Config) error
 
@@ -47,9 +176,40 @@ type Storer interface {
 	DeleteHub(params DeleteHubParams) (bool, error)
 	GetHub(params GetHubParams) (hub.Hub, error)
 	GetHubs(params GetHubsParams) ([]hub.Hub, error)
+	// GetHubByName returns the hub having the given name, regardless of case.
+	GetHubByName(params GetHubByNameParams) (hub.Hub, error)
+	// SearchHubs returns the hubs whose names start with a prefix, sorted by name.
+	SearchHubs(params SearchHubsParams) ([]hub.Hub, error)
 	AddChannel(params AddChannelParams) error
 	DeleteChannel(params DeleteChannelParams) (bool, error)
+	UpdateHubSettings(params UpdateHubSettingsParams) error
+	UpdateHubDetails(params UpdateHubDetailsParams) error
+	AddModerator(params AddModeratorParams) error
+	RemoveModerator(params RemoveModeratorParams) (bool, error)
 	GetHubsCount(params GetHubsCountParams) (uint, error)
 	GetChannelsCount(params GetChannelsCountParams) (uint, error)
 	GetHubOfChannel(params GetHubOfChannelParams) (hub.Hub, error)
+	SetWebhook(params SetWebhookParams) error
+	GetWebhook(params GetWebhookParams) (webhook.Webhook, error)
+	DeleteWebhook(params DeleteWebhookParams) (bool, error)
+	AddMessageLink(params AddMessageLinkParams) error
+	AddMirror(params AddMirrorParams) error
+	GetMessageLink(params GetMessageLinkParams) (link.MessageLink, error)
+	// SetFingerprint records the state of an original message last relayed to its mirrors.
+	SetFingerprint(params SetFingerprintParams) error
+	DeleteMirror(params DeleteMirrorParams) (bool, error)
+	DeleteMessageLink(params DeleteMessageLinkParams) (bool, error)
+	// AddReaction records a user reacting to a linked message and returns the number of users reacting with the emoji.
+	AddReaction(params AddReactionParams) (uint, error)
+	// RemoveReaction forgets a user reacting to a linked message and returns the number of users still reacting with the emoji.
+	RemoveReaction(params RemoveReactionParams) (uint, error)
+	GetReactions(params GetReactionsParams) ([]link.Reaction, error)
+	AddDeadLetter(params AddDeadLetterParams) error
+	GetDeadLetters(params GetDeadLettersParams) ([]deadletter.DeadLetter, error)
+	DeleteDeadLetter(params DeleteDeadLetterParams) (bool, error)
+	AddThreadLink(params AddThreadLinkParams) error
+	AddThreadMirror(params AddThreadMirrorParams) error
+	GetThreadLink(params GetThreadLinkParams) (link.ThreadLink, error)
+	DeleteThreadLink(params DeleteThreadLinkParams) (bool, error)
+	DeleteThreadMirror(params DeleteThreadMirrorParams) (bool, error)
 }
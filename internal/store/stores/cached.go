@@ -0,0 +1,157 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/store"
+)
+
+// CachedStore caches the hub of each channel in front of another store, channels outside of hubs included.
+// The cache is cleared whenever a hub changes through this store, and its entries expire after a TTL
+// so that changes made by other instances sharing the store are eventually seen.
+type CachedStore struct {
+	store.Storer
+
+	mu       sync.RWMutex
+	ttl      time.Duration
+	channels map[string]cachedHub
+	// generation counts the invalidations, so that lookups started before one don't cache what they read
+	generation uint64
+	// lastSweep is when expired entries were last removed
+	lastSweep time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cachedHub is the cached hub of a channel, found being false for channels outside of hubs.
+type cachedHub struct {
+	hub      hub.Hub
+	found    bool
+	cachedAt time.Time
+}
+
+// CacheStats reports how often hub lookups were served from the cache.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+func NewCachedStore(storer store.Storer, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		Storer:   storer,
+		ttl:      ttl,
+		channels: make(map[string]cachedHub),
+	}
+}
+
+// Stats returns the hit and miss counts of the cache.
+func (c *CachedStore) Stats() CacheStats {
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// invalidate clears the cache, hubs changing rarely compared to how often they are looked up.
+func (c *CachedStore) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.channels = make(map[string]cachedHub)
+	c.generation++
+}
+
+// sweep removes the expired entries, at most once per TTL, so that channels which aren't looked up anymore don't stay cached.
+// The caller must hold the write lock.
+func (c *CachedStore) sweep() {
+	if time.Since(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = time.Now()
+
+	for channelID, entry := range c.channels {
+		if time.Since(entry.cachedAt) > c.ttl {
+			delete(c.channels, channelID)
+		}
+	}
+}
+
+func (c *CachedStore) GetHubOfChannel(params store.GetHubOfChannelParams) (hub.Hub, error) {
+	c.mu.RLock()
+	entry, ok := c.channels[params.ChannelID]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if ok && time.Since(entry.cachedAt) <= c.ttl {
+		c.hits.Add(1)
+		if !entry.found {
+			return hub.Hub{}, fmt.Errorf("hub of channel %s %w", params.ChannelID, store.ErrNotFound)
+		}
+		return entry.hub, nil
+	}
+	c.misses.Add(1)
+
+	h, err := c.Storer.GetHubOfChannel(params)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return hub.Hub{}, err
+	}
+
+	c.mu.Lock()
+	c.sweep()
+	if c.generation == generation {
+		c.channels[params.ChannelID] = cachedHub{
+			hub:      h,
+			found:    err == nil,
+			cachedAt: time.Now(),
+		}
+	}
+	c.mu.Unlock()
+
+	return h, err
+}
+
+func (c *CachedStore) AddHub(params store.AddHubParams) error {
+	defer c.invalidate()
+	return c.Storer.AddHub(params)
+}
+
+func (c *CachedStore) DeleteHub(params store.DeleteHubParams) (bool, error) {
+	defer c.invalidate()
+	return c.Storer.DeleteHub(params)
+}
+
+func (c *CachedStore) AddChannel(params store.AddChannelParams) error {
+	defer c.invalidate()
+	return c.Storer.AddChannel(params)
+}
+
+func (c *CachedStore) DeleteChannel(params store.DeleteChannelParams) (bool, error) {
+	defer c.invalidate()
+	return c.Storer.DeleteChannel(params)
+}
+
+func (c *CachedStore) UpdateHubSettings(params store.UpdateHubSettingsParams) error {
+	defer c.invalidate()
+	return c.Storer.UpdateHubSettings(params)
+}
+
+func (c *CachedStore) UpdateHubDetails(params store.UpdateHubDetailsParams) error {
+	defer c.invalidate()
+	return c.Storer.UpdateHubDetails(params)
+}
+
+func (c *CachedStore) AddModerator(params store.AddModeratorParams) error {
+	defer c.invalidate()
+	return c.Storer.AddModerator(params)
+}
+
+func (c *CachedStore) RemoveModerator(params store.RemoveModeratorParams) (bool, error) {
+	defer c.invalidate()
+	return c.Storer.RemoveModerator(params)
+}
@@ -2,21 +2,52 @@ package stores
 
 import (
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/maaxleq/agora-bot/internal/config"
+	"github.com/maaxleq/agora-bot/internal/deadletter"
 	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
 	"github.com/maaxleq/agora-bot/internal/store"
+	"github.com/maaxleq/agora-bot/internal/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type MemoryStore struct {
-	hubs []hub.Hub
+	mu       sync.RWMutex
+	hubs     []hub.Hub
+	webhooks map[string]webhook.Webhook
+
+	links       map[string]link.MessageLink
+	mirrorLinks map[string]string
+	reactions   map[string]map[string]map[string]struct{}
+	linkTTL     time.Duration
+	lastPrune   time.Time
+
+	deadLetters []deadletter.DeadLetter
+
+	threadLinks   map[string]link.ThreadLink
+	mirrorThreads map[string]string
 }
 
 func (m *MemoryStore) Configure(config config.Config) error {
+	m.linkTTL = config.MessageLinkTTL
+	m.links = make(map[string]link.MessageLink)
+	m.mirrorLinks = make(map[string]string)
+	m.reactions = make(map[string]map[string]map[string]struct{})
+	m.threadLinks = make(map[string]link.ThreadLink)
+	m.mirrorThreads = make(map[string]string)
 	return nil
 }
 
 func (m *MemoryStore) AddHub(params store.AddHubParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Check that the hub doesn't already exist
 	for _, h := range m.hubs {
 		if h.ID == params.Hub.ID {
@@ -24,11 +55,21 @@ func (m *MemoryStore) AddHub(params store.AddHubParams) error {
 		}
 	}
 
-	m.hubs = append(m.hubs, params.Hub)
+	m.hubs = append(m.hubs, copyHub(params.Hub))
 	return nil
 }
 
+// copyHub copies the slices of a hub, so that hubs handed out by the store don't share memory with the stored ones.
+func copyHub(h hub.Hub) hub.Hub {
+	h.Channels = append([]string{}, h.Channels...)
+	h.Moderators = append([]string{}, h.Moderators...)
+	return h
+}
+
 func (m *MemoryStore) DeleteHub(params store.DeleteHubParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for i, h := range m.hubs {
 		if h.ID == params.ID {
 			m.hubs = append(m.hubs[:i], m.hubs[i+1:]...)
@@ -39,29 +80,78 @@ func (m *MemoryStore) DeleteHub(params store.DeleteHubParams) (bool, error) {
 }
 
 func (m *MemoryStore) GetHub(params store.GetHubParams) (hub.Hub, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, h := range m.hubs {
 		if h.ID == params.ID {
-			return h, nil
+			return copyHub(h), nil
 		}
 	}
-	return hub.Hub{}, fmt.Errorf("hub %s not found", params.ID.String())
+	return hub.Hub{}, fmt.Errorf("hub %s %w", params.ID.String(), store.ErrNotFound)
 }
 
 func (m *MemoryStore) GetHubs(params store.GetHubsParams) ([]hub.Hub, error) {
-	return m.hubs, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hubs := make([]hub.Hub, len(m.hubs))
+	for i, h := range m.hubs {
+		hubs[i] = copyHub(h)
+	}
+	return hubs, nil
+}
+
+func (m *MemoryStore) GetHubByName(params store.GetHubByNameParams) (hub.Hub, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, h := range m.hubs {
+		if strings.EqualFold(h.Name, params.Name) {
+			return copyHub(h), nil
+		}
+	}
+	return hub.Hub{}, fmt.Errorf("hub named %s %w", params.Name, store.ErrNotFound)
+}
+
+func (m *MemoryStore) SearchHubs(params store.SearchHubsParams) ([]hub.Hub, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefix := strings.ToLower(params.Prefix)
+	var hubs []hub.Hub
+	for _, h := range m.hubs {
+		if strings.HasPrefix(strings.ToLower(h.Name), prefix) {
+			hubs = append(hubs, copyHub(h))
+		}
+	}
+
+	sort.Slice(hubs, func(i, j int) bool {
+		return strings.ToLower(hubs[i].Name) < strings.ToLower(hubs[j].Name)
+	})
+	if params.Limit > 0 && len(hubs) > params.Limit {
+		hubs = hubs[:params.Limit]
+	}
+	return hubs, nil
 }
 
 func (m *MemoryStore) AddChannel(params store.AddChannelParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for i, h := range m.hubs {
 		if h.ID == params.HubID {
 			m.hubs[i].Channels = append(m.hubs[i].Channels, params.ChannelID)
 			return nil
 		}
 	}
-	return fmt.Errorf("hub %s not found", params.HubID.String())
+	return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
 }
 
 func (m *MemoryStore) DeleteChannel(params store.DeleteChannelParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for i, h := range m.hubs {
 		if h.ID == params.HubID {
 			for j, c := range h.Channels {
@@ -75,26 +165,462 @@ func (m *MemoryStore) DeleteChannel(params store.DeleteChannelParams) (bool, err
 	return false, nil
 }
 
+func (m *MemoryStore) UpdateHubSettings(params store.UpdateHubSettingsParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, h := range m.hubs {
+		if h.ID == params.HubID {
+			m.hubs[i].Settings = params.Settings
+			return nil
+		}
+	}
+	return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
+}
+
+func (m *MemoryStore) UpdateHubDetails(params store.UpdateHubDetailsParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, h := range m.hubs {
+		if h.ID == params.HubID {
+			m.hubs[i].Name = params.Name
+			m.hubs[i].Description = params.Description
+			return nil
+		}
+	}
+	return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
+}
+
+func (m *MemoryStore) AddModerator(params store.AddModeratorParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, h := range m.hubs {
+		if h.ID == params.HubID {
+			if !slices.Contains(h.Moderators, params.UserID) {
+				m.hubs[i].Moderators = append(m.hubs[i].Moderators, params.UserID)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
+}
+
+func (m *MemoryStore) RemoveModerator(params store.RemoveModeratorParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, h := range m.hubs {
+		if h.ID == params.HubID {
+			for j, moderatorID := range h.Moderators {
+				if moderatorID == params.UserID {
+					m.hubs[i].Moderators = append(h.Moderators[:j], h.Moderators[j+1:]...)
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
 func (m *MemoryStore) GetHubsCount(params store.GetHubsCountParams) (uint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return uint(len(m.hubs)), nil
 }
 
 func (m *MemoryStore) GetChannelsCount(params store.GetChannelsCountParams) (uint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, h := range m.hubs {
 		if h.ID == params.HubID {
 			return uint(len(h.Channels)), nil
 		}
 	}
-	return 0, fmt.Errorf("hub %s not found", params.HubID.String())
+	return 0, fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
 }
 
 func (m *MemoryStore) GetHubOfChannel(params store.GetHubOfChannelParams) (hub.Hub, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, h := range m.hubs {
 		for _, c := range h.Channels {
 			if c == params.ChannelID {
-				return h, nil
+				return copyHub(h), nil
 			}
 		}
 	}
-	return hub.Hub{}, fmt.Errorf("channel %s not found", params.ChannelID)
+	return hub.Hub{}, fmt.Errorf("hub of channel %s %w", params.ChannelID, store.ErrNotFound)
+}
+
+func (m *MemoryStore) SetWebhook(params store.SetWebhookParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.webhooks == nil {
+		m.webhooks = make(map[string]webhook.Webhook)
+	}
+	m.webhooks[params.Webhook.ChannelID] = params.Webhook
+	return nil
+}
+
+func (m *MemoryStore) GetWebhook(params store.GetWebhookParams) (webhook.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wh, ok := m.webhooks[params.ChannelID]
+	if !ok {
+		return webhook.Webhook{}, fmt.Errorf("webhook for channel %s %w", params.ChannelID, store.ErrNotFound)
+	}
+	return wh, nil
+}
+
+func (m *MemoryStore) DeleteWebhook(params store.DeleteWebhookParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[params.ChannelID]; !ok {
+		return false, nil
+	}
+	delete(m.webhooks, params.ChannelID)
+	return true, nil
+}
+
+// linkExpired reports whether the given message link outlived the configured TTL.
+func (m *MemoryStore) linkExpired(l link.MessageLink) bool {
+	return m.linkTTL > 0 && time.Since(l.CreatedAt) > m.linkTTL
+}
+
+// deleteLink removes a message link and the index entries of its mirrors.
+func (m *MemoryStore) deleteLink(l link.MessageLink) {
+	for _, mirror := range l.Mirrors {
+		delete(m.mirrorLinks, mirror.MessageID)
+	}
+	delete(m.links, l.OriginMessageID)
+	delete(m.reactions, l.OriginMessageID)
+}
+
+// threadLinkExpired reports whether the given thread link outlived the configured TTL.
+func (m *MemoryStore) threadLinkExpired(l link.ThreadLink) bool {
+	return m.linkTTL > 0 && time.Since(l.CreatedAt) > m.linkTTL
+}
+
+// deleteThreadLink removes a thread link and the index entries of its mirrors.
+func (m *MemoryStore) deleteThreadLink(l link.ThreadLink) {
+	for _, mirror := range l.Threads {
+		delete(m.mirrorThreads, mirror.ThreadID)
+	}
+	delete(m.threadLinks, l.OriginThreadID)
+}
+
+// pruneLinks removes expired message and thread links, at most once per minute.
+func (m *MemoryStore) pruneLinks() {
+	if time.Since(m.lastPrune) < time.Minute {
+		return
+	}
+	m.lastPrune = time.Now()
+
+	for _, l := range m.links {
+		if m.linkExpired(l) {
+			m.deleteLink(l)
+		}
+	}
+	for _, l := range m.threadLinks {
+		if m.threadLinkExpired(l) {
+			m.deleteThreadLink(l)
+		}
+	}
+}
+
+func (m *MemoryStore) AddMessageLink(params store.AddMessageLinkParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneLinks()
+
+	if l, ok := m.links[params.Link.OriginMessageID]; ok {
+		if !m.linkExpired(l) {
+			return fmt.Errorf("message link %s already exists", params.Link.OriginMessageID)
+		}
+		m.deleteLink(l)
+	}
+
+	m.links[params.Link.OriginMessageID] = params.Link
+	for _, mirror := range params.Link.Mirrors {
+		m.mirrorLinks[mirror.MessageID] = params.Link.OriginMessageID
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddMirror(params store.AddMirrorParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[params.OriginMessageID]
+	if !ok || m.linkExpired(l) {
+		return fmt.Errorf("message link %s %w", params.OriginMessageID, store.ErrNotFound)
+	}
+
+	l.Mirrors = append(l.Mirrors, params.Mirror)
+	m.links[params.OriginMessageID] = l
+	m.mirrorLinks[params.Mirror.MessageID] = params.OriginMessageID
+	return nil
+}
+
+func (m *MemoryStore) GetMessageLink(params store.GetMessageLinkParams) (link.MessageLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	originID := params.MessageID
+	if id, ok := m.mirrorLinks[params.MessageID]; ok {
+		originID = id
+	}
+
+	l, ok := m.links[originID]
+	if !ok || m.linkExpired(l) {
+		return link.MessageLink{}, fmt.Errorf("message link for %s %w", params.MessageID, store.ErrNotFound)
+	}
+
+	l.Mirrors = append([]link.Mirror(nil), l.Mirrors...)
+	return l, nil
+}
+
+func (m *MemoryStore) SetFingerprint(params store.SetFingerprintParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[params.OriginMessageID]
+	if !ok || m.linkExpired(l) {
+		return fmt.Errorf("message link %s %w", params.OriginMessageID, store.ErrNotFound)
+	}
+
+	l.Fingerprint = params.Fingerprint
+	m.links[params.OriginMessageID] = l
+	return nil
+}
+
+func (m *MemoryStore) DeleteMirror(params store.DeleteMirrorParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	originID, ok := m.mirrorLinks[params.MessageID]
+	if !ok {
+		return false, nil
+	}
+	delete(m.mirrorLinks, params.MessageID)
+
+	l := m.links[originID]
+	for i, mirror := range l.Mirrors {
+		if mirror.MessageID == params.MessageID {
+			l.Mirrors = append(l.Mirrors[:i:i], l.Mirrors[i+1:]...)
+			break
+		}
+	}
+	m.links[originID] = l
+	return true, nil
+}
+
+func (m *MemoryStore) DeleteMessageLink(params store.DeleteMessageLinkParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[params.OriginMessageID]
+	if !ok {
+		return false, nil
+	}
+
+	m.deleteLink(l)
+	return true, nil
+}
+
+func (m *MemoryStore) AddReaction(params store.AddReactionParams) (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	emojis, ok := m.reactions[params.OriginMessageID]
+	if !ok {
+		emojis = make(map[string]map[string]struct{})
+		m.reactions[params.OriginMessageID] = emojis
+	}
+
+	users, ok := emojis[params.Emoji]
+	if !ok {
+		users = make(map[string]struct{})
+		emojis[params.Emoji] = users
+	}
+
+	users[params.UserID] = struct{}{}
+	return uint(len(users)), nil
+}
+
+func (m *MemoryStore) RemoveReaction(params store.RemoveReactionParams) (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users, ok := m.reactions[params.OriginMessageID][params.Emoji]
+	if !ok {
+		return 0, nil
+	}
+
+	delete(users, params.UserID)
+	if len(users) == 0 {
+		delete(m.reactions[params.OriginMessageID], params.Emoji)
+	}
+	return uint(len(users)), nil
+}
+
+func (m *MemoryStore) GetReactions(params store.GetReactionsParams) ([]link.Reaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reactions []link.Reaction
+	for emoji, users := range m.reactions[params.OriginMessageID] {
+		if len(users) == 0 {
+			continue
+		}
+
+		reaction := link.Reaction{
+			OriginMessageID: params.OriginMessageID,
+			Emoji:           emoji,
+		}
+		for userID := range users {
+			reaction.UserIDs = append(reaction.UserIDs, userID)
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions, nil
+}
+
+func (m *MemoryStore) AddDeadLetter(params store.AddDeadLetterParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dl := params.DeadLetter
+	if dl.ID.IsZero() {
+		dl.ID = primitive.NewObjectID()
+	}
+
+	// Dead letters expire along with the message links they refer to
+	kept := m.deadLetters[:0]
+	for _, existing := range m.deadLetters {
+		if m.linkTTL <= 0 || time.Since(existing.CreatedAt) <= m.linkTTL {
+			kept = append(kept, existing)
+		}
+	}
+	m.deadLetters = append(kept, dl)
+	return nil
+}
+
+func (m *MemoryStore) GetDeadLetters(params store.GetDeadLettersParams) ([]deadletter.DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deadLetters []deadletter.DeadLetter
+	for _, dl := range m.deadLetters {
+		if dl.HubID == params.HubID {
+			deadLetters = append(deadLetters, dl)
+		}
+	}
+	return deadLetters, nil
+}
+
+func (m *MemoryStore) DeleteDeadLetter(params store.DeleteDeadLetterParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, dl := range m.deadLetters {
+		if dl.ID == params.ID {
+			m.deadLetters = append(m.deadLetters[:i], m.deadLetters[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) AddThreadLink(params store.AddThreadLinkParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneLinks()
+
+	if _, ok := m.threadLinks[params.Link.OriginThreadID]; ok {
+		return fmt.Errorf("thread link %s already exists", params.Link.OriginThreadID)
+	}
+
+	m.threadLinks[params.Link.OriginThreadID] = params.Link
+	for _, mirror := range params.Link.Threads {
+		m.mirrorThreads[mirror.ThreadID] = params.Link.OriginThreadID
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddThreadMirror(params store.AddThreadMirrorParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.threadLinks[params.OriginThreadID]
+	if !ok {
+		return fmt.Errorf("thread link %s %w", params.OriginThreadID, store.ErrNotFound)
+	}
+
+	l.Threads = append(l.Threads, params.Mirror)
+	m.threadLinks[params.OriginThreadID] = l
+	m.mirrorThreads[params.Mirror.ThreadID] = params.OriginThreadID
+	return nil
+}
+
+func (m *MemoryStore) GetThreadLink(params store.GetThreadLinkParams) (link.ThreadLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	originID := params.ThreadID
+	if id, ok := m.mirrorThreads[params.ThreadID]; ok {
+		originID = id
+	}
+
+	l, ok := m.threadLinks[originID]
+	if !ok || m.threadLinkExpired(l) {
+		return link.ThreadLink{}, fmt.Errorf("thread link for %s %w", params.ThreadID, store.ErrNotFound)
+	}
+
+	l.Threads = append([]link.ThreadMirror(nil), l.Threads...)
+	return l, nil
+}
+
+func (m *MemoryStore) DeleteThreadLink(params store.DeleteThreadLinkParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.threadLinks[params.OriginThreadID]
+	if !ok {
+		return false, nil
+	}
+
+	m.deleteThreadLink(l)
+	return true, nil
+}
+
+func (m *MemoryStore) DeleteThreadMirror(params store.DeleteThreadMirrorParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	originID, ok := m.mirrorThreads[params.ThreadID]
+	if !ok {
+		return false, nil
+	}
+	delete(m.mirrorThreads, params.ThreadID)
+
+	l := m.threadLinks[originID]
+	for i, mirror := range l.Threads {
+		if mirror.ThreadID == params.ThreadID {
+			l.Threads = append(l.Threads[:i:i], l.Threads[i+1:]...)
+			break
+		}
+	}
+	m.threadLinks[originID] = l
+	return true, nil
 }
@@ -2,23 +2,46 @@ package stores
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/maaxleq/agora-bot/internal/config"
+	"github.com/maaxleq/agora-bot/internal/deadletter"
 	"github.com/maaxleq/agora-bot/internal/hub"
+	"github.com/maaxleq/agora-bot/internal/link"
 	"github.com/maaxleq/agora-bot/internal/store"
+	"github.com/maaxleq/agora-bot/internal/webhook"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MongoStore struct {
-	client     *mongo.Client
-	database   *mongo.Database
-	collection *mongo.Collection
+	client      *mongo.Client
+	database    *mongo.Database
+	collection  *mongo.Collection
+	webhooks    *mongo.Collection
+	links       *mongo.Collection
+	reactions   *mongo.Collection
+	deadLetters *mongo.Collection
+	threads     *mongo.Collection
 }
 
+// nameCollation compares hub names regardless of case.
+var nameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// indexOptionsConflictCode is the MongoDB error code returned when an index already exists with other options.
+const indexOptionsConflictCode = 85
+
+// indexNotFoundCode is the MongoDB error code returned when dropping an index which doesn't exist.
+const indexNotFoundCode = 27
+
+// ttlIndexName is the name of the TTL indexes on created_at, the default name MongoDB gives them.
+const ttlIndexName = "created_at_1"
+
 func NewMongoStorer() *MongoStore {
 	return &MongoStore{}
 }
@@ -41,6 +64,11 @@ func (m *MongoStore) Configure(config config.Config) error {
 	m.client = client
 	m.database = client.Database(config.MongoDB)
 	m.collection = m.database.Collection("hubs")
+	m.webhooks = m.database.Collection("webhooks")
+	m.links = m.database.Collection("message_links")
+	m.reactions = m.database.Collection("reactions")
+	m.deadLetters = m.database.Collection("dead_letters")
+	m.threads = m.database.Collection("thread_links")
 
 	// Create index on channels array for faster channel lookups
 	_, err = m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
@@ -50,6 +78,94 @@ func (m *MongoStore) Configure(config config.Config) error {
 		return fmt.Errorf("failed to create channels index: %w", err)
 	}
 
+	_, err = m.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetCollation(nameCollation),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create names index: %w", err)
+	}
+
+	// Create index on mirrors for lookups from a mirrored message
+	_, err = m.links.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "mirrors.message_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create mirrors index: %w", err)
+	}
+
+	// Create index on reactions for lookups by message and emoji
+	_, err = m.reactions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "origin_message_id", Value: 1}, {Key: "emoji", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create reactions index: %w", err)
+	}
+
+	if err = m.configureTTL(ctx, m.links, config.MessageLinkTTL); err != nil {
+		return err
+	}
+	if err = m.configureTTL(ctx, m.reactions, config.MessageLinkTTL); err != nil {
+		return err
+	}
+
+	// Create index on dead letters for lookups by hub, they expire along with the message links they refer to
+	_, err = m.deadLetters.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "hub_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create dead letters index: %w", err)
+	}
+	if err = m.configureTTL(ctx, m.deadLetters, config.MessageLinkTTL); err != nil {
+		return err
+	}
+
+	// Create index on thread mirrors for lookups from a mirrored thread
+	_, err = m.threads.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "threads.thread_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create thread mirrors index: %w", err)
+	}
+	if err = m.configureTTL(ctx, m.threads, config.MessageLinkTTL); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// configureTTL creates the TTL index expiring the documents of a collection, updating its expiry if it already exists.
+// A TTL of 0 or less keeps the documents forever, dropping the TTL index created by a previous configuration.
+func (m *MongoStore) configureTTL(ctx context.Context, collection *mongo.Collection, ttl time.Duration) error {
+	if ttl <= 0 {
+		_, err := collection.Indexes().DropOne(ctx, ttlIndexName)
+		var cmdErr mongo.CommandError
+		if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == indexNotFoundCode) {
+			return fmt.Errorf("failed to drop %s TTL index: %w", collection.Name(), err)
+		}
+		return nil
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName(ttlIndexName).SetExpireAfterSeconds(int32(ttl.Seconds())),
+	})
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == indexOptionsConflictCode {
+		err = m.database.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection.Name()},
+			{Key: "index", Value: bson.D{
+				{Key: "keyPattern", Value: bson.D{{Key: "created_at", Value: 1}}},
+				{Key: "expireAfterSeconds", Value: int32(ttl.Seconds())},
+			}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s TTL index: %w", collection.Name(), err)
+	}
+
 	return nil
 }
 
@@ -95,7 +211,7 @@ func (m *MongoStore) GetHub(params store.GetHubParams) (hub.Hub, error) {
 	var result hub.Hub
 	err := m.collection.FindOne(ctx, bson.M{"_id": params.ID}).Decode(&result)
 	if err == mongo.ErrNoDocuments {
-		return hub.Hub{}, fmt.Errorf("hub %s not found", params.ID.String())
+		return hub.Hub{}, fmt.Errorf("hub %s %w", params.ID.String(), store.ErrNotFound)
 	}
 	if err != nil {
 		return hub.Hub{}, fmt.Errorf("failed to get hub: %w", err)
@@ -122,6 +238,46 @@ func (m *MongoStore) GetHubs(params store.GetHubsParams) ([]hub.Hub, error) {
 	return hubs, nil
 }
 
+func (m *MongoStore) GetHubByName(params store.GetHubByNameParams) (hub.Hub, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result hub.Hub
+	err := m.collection.FindOne(ctx, bson.M{"name": params.Name}, options.FindOne().SetCollation(nameCollation)).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return hub.Hub{}, fmt.Errorf("hub named %s %w", params.Name, store.ErrNotFound)
+	}
+	if err != nil {
+		return hub.Hub{}, fmt.Errorf("failed to get hub by name: %w", err)
+	}
+
+	return result, nil
+}
+
+func (m *MongoStore) SearchHubs(params store.SearchHubsParams) ([]hub.Hub, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"name": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(params.Prefix), Options: "i"}}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetCollation(nameCollation)
+	if params.Limit > 0 {
+		opts.SetLimit(int64(params.Limit))
+	}
+
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search hubs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var hubs []hub.Hub
+	if err = cursor.All(ctx, &hubs); err != nil {
+		return nil, fmt.Errorf("failed to decode hubs: %w", err)
+	}
+
+	return hubs, nil
+}
+
 func (m *MongoStore) AddChannel(params store.AddChannelParams) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -135,7 +291,7 @@ func (m *MongoStore) AddChannel(params store.AddChannelParams) error {
 		return fmt.Errorf("failed to add channel: %w", err)
 	}
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("hub %s not found", params.HubID.String())
+		return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
 	}
 
 	return nil
@@ -157,6 +313,79 @@ func (m *MongoStore) DeleteChannel(params store.DeleteChannelParams) (bool, erro
 	return result.ModifiedCount > 0, nil
 }
 
+func (m *MongoStore) UpdateHubSettings(params store.UpdateHubSettingsParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": params.HubID},
+		bson.M{"$set": bson.M{"settings": params.Settings}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update hub settings: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) UpdateHubDetails(params store.UpdateHubDetailsParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": params.HubID},
+		bson.M{"$set": bson.M{"name": params.Name, "description": params.Description}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update hub details: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) AddModerator(params store.AddModeratorParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": params.HubID},
+		bson.M{"$addToSet": bson.M{"moderators": params.UserID}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add moderator: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) RemoveModerator(params store.RemoveModeratorParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": params.HubID},
+		bson.M{"$pull": bson.M{"moderators": params.UserID}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove moderator: %w", err)
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
 func (m *MongoStore) GetHubsCount(params store.GetHubsCountParams) (uint, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -176,7 +405,7 @@ func (m *MongoStore) GetChannelsCount(params store.GetChannelsCountParams) (uint
 	var hub hub.Hub
 	err := m.collection.FindOne(ctx, bson.M{"_id": params.HubID}).Decode(&hub)
 	if err == mongo.ErrNoDocuments {
-		return 0, fmt.Errorf("hub %s not found", params.HubID.String())
+		return 0, fmt.Errorf("hub %s %w", params.HubID.String(), store.ErrNotFound)
 	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to get hub: %w", err)
@@ -195,7 +424,7 @@ func (m *MongoStore) GetHubOfChannel(params store.GetHubOfChannelParams) (hub.Hu
 	}).Decode(&foundHub)
 
 	if err == mongo.ErrNoDocuments {
-		return hub.Hub{}, fmt.Errorf("channel %s not found", params.ChannelID)
+		return hub.Hub{}, fmt.Errorf("hub of channel %s %w", params.ChannelID, store.ErrNotFound)
 	}
 	if err != nil {
 		return hub.Hub{}, fmt.Errorf("failed to get channel: %w", err)
@@ -203,3 +432,348 @@ func (m *MongoStore) GetHubOfChannel(params store.GetHubOfChannelParams) (hub.Hu
 
 	return foundHub, nil
 }
+
+func (m *MongoStore) SetWebhook(params store.SetWebhookParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.webhooks.ReplaceOne(
+		ctx,
+		bson.M{"_id": params.Webhook.ChannelID},
+		params.Webhook,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) GetWebhook(params store.GetWebhookParams) (webhook.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result webhook.Webhook
+	err := m.webhooks.FindOne(ctx, bson.M{"_id": params.ChannelID}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return webhook.Webhook{}, fmt.Errorf("webhook for channel %s %w", params.ChannelID, store.ErrNotFound)
+	}
+	if err != nil {
+		return webhook.Webhook{}, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return result, nil
+}
+
+func (m *MongoStore) DeleteWebhook(params store.DeleteWebhookParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.webhooks.DeleteOne(ctx, bson.M{"_id": params.ChannelID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+func (m *MongoStore) AddMessageLink(params store.AddMessageLinkParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if params.Link.Mirrors == nil {
+		params.Link.Mirrors = []link.Mirror{}
+	}
+
+	_, err := m.links.InsertOne(ctx, params.Link)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("message link %s already exists", params.Link.OriginMessageID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert message link: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) AddMirror(params store.AddMirrorParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.links.UpdateOne(
+		ctx,
+		bson.M{"_id": params.OriginMessageID},
+		bson.M{"$push": bson.M{"mirrors": params.Mirror}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add mirror: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("message link %s %w", params.OriginMessageID, store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) GetMessageLink(params store.GetMessageLinkParams) (link.MessageLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result link.MessageLink
+	err := m.links.FindOne(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"_id": params.MessageID},
+			bson.M{"mirrors.message_id": params.MessageID},
+		},
+	}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return link.MessageLink{}, fmt.Errorf("message link for %s %w", params.MessageID, store.ErrNotFound)
+	}
+	if err != nil {
+		return link.MessageLink{}, fmt.Errorf("failed to get message link: %w", err)
+	}
+
+	return result, nil
+}
+
+func (m *MongoStore) SetFingerprint(params store.SetFingerprintParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.links.UpdateOne(
+		ctx,
+		bson.M{"_id": params.OriginMessageID},
+		bson.M{"$set": bson.M{"fingerprint": params.Fingerprint}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set fingerprint: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("message link %s %w", params.OriginMessageID, store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) DeleteMirror(params store.DeleteMirrorParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.links.UpdateOne(
+		ctx,
+		bson.M{"mirrors.message_id": params.MessageID},
+		bson.M{"$pull": bson.M{"mirrors": bson.M{"message_id": params.MessageID}}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete mirror: %w", err)
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+func (m *MongoStore) DeleteMessageLink(params store.DeleteMessageLinkParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.links.DeleteOne(ctx, bson.M{"_id": params.OriginMessageID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete message link: %w", err)
+	}
+
+	_, err = m.reactions.DeleteMany(ctx, bson.M{"origin_message_id": params.OriginMessageID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete reactions: %w", err)
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+func (m *MongoStore) AddReaction(params store.AddReactionParams) (uint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result link.Reaction
+	err := m.reactions.FindOneAndUpdate(
+		ctx,
+		bson.M{"origin_message_id": params.OriginMessageID, "emoji": params.Emoji},
+		bson.M{
+			"$addToSet":    bson.M{"user_ids": params.UserID},
+			"$setOnInsert": bson.M{"created_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&result)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	return uint(len(result.UserIDs)), nil
+}
+
+func (m *MongoStore) RemoveReaction(params store.RemoveReactionParams) (uint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result link.Reaction
+	err := m.reactions.FindOneAndUpdate(
+		ctx,
+		bson.M{"origin_message_id": params.OriginMessageID, "emoji": params.Emoji},
+		bson.M{"$pull": bson.M{"user_ids": params.UserID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	return uint(len(result.UserIDs)), nil
+}
+
+func (m *MongoStore) GetReactions(params store.GetReactionsParams) ([]link.Reaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := m.reactions.Find(ctx, bson.M{"origin_message_id": params.OriginMessageID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var reactions []link.Reaction
+	if err = cursor.All(ctx, &reactions); err != nil {
+		return nil, fmt.Errorf("failed to decode reactions: %w", err)
+	}
+
+	return reactions, nil
+}
+
+func (m *MongoStore) AddDeadLetter(params store.AddDeadLetterParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.deadLetters.InsertOne(ctx, params.DeadLetter)
+	if err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) GetDeadLetters(params store.GetDeadLettersParams) ([]deadletter.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := m.deadLetters.Find(ctx, bson.M{"hub_id": params.HubID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letters: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var deadLetters []deadletter.DeadLetter
+	if err = cursor.All(ctx, &deadLetters); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letters: %w", err)
+	}
+
+	return deadLetters, nil
+}
+
+func (m *MongoStore) DeleteDeadLetter(params store.DeleteDeadLetterParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.deadLetters.DeleteOne(ctx, bson.M{"_id": params.ID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+func (m *MongoStore) AddThreadLink(params store.AddThreadLinkParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if params.Link.Threads == nil {
+		params.Link.Threads = []link.ThreadMirror{}
+	}
+
+	_, err := m.threads.InsertOne(ctx, params.Link)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("thread link %s already exists", params.Link.OriginThreadID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert thread link: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) AddThreadMirror(params store.AddThreadMirrorParams) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.threads.UpdateOne(
+		ctx,
+		bson.M{"_id": params.OriginThreadID},
+		bson.M{"$push": bson.M{"threads": params.Mirror}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add thread mirror: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("thread link %s %w", params.OriginThreadID, store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *MongoStore) GetThreadLink(params store.GetThreadLinkParams) (link.ThreadLink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var result link.ThreadLink
+	err := m.threads.FindOne(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"_id": params.ThreadID},
+			bson.M{"threads.thread_id": params.ThreadID},
+		},
+	}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return link.ThreadLink{}, fmt.Errorf("thread link for %s %w", params.ThreadID, store.ErrNotFound)
+	}
+	if err != nil {
+		return link.ThreadLink{}, fmt.Errorf("failed to get thread link: %w", err)
+	}
+
+	return result, nil
+}
+
+func (m *MongoStore) DeleteThreadLink(params store.DeleteThreadLinkParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.threads.DeleteOne(ctx, bson.M{"_id": params.OriginThreadID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete thread link: %w", err)
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+func (m *MongoStore) DeleteThreadMirror(params store.DeleteThreadMirrorParams) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := m.threads.UpdateOne(
+		ctx,
+		bson.M{"threads.thread_id": params.ThreadID},
+		bson.M{"$pull": bson.M{"threads": bson.M{"thread_id": params.ThreadID}}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete thread mirror: %w", err)
+	}
+
+	return result.ModifiedCount > 0, nil
+}
@@ -0,0 +1,8 @@
+package webhook
+
+// Webhook holds the credentials of the webhook used to relay messages into a hub channel.
+type Webhook struct {
+	ChannelID string `bson:"_id" json:"channel_id"`
+	ID        string `bson:"webhook_id" json:"webhook_id"`
+	Token     string `bson:"token" json:"token"`
+}